@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+const (
+	auditReload = "reload"
+	auditEnv    = "env"
+	auditSet    = "set"
+	auditEdit   = "edit"
+	auditName   = "audit.jsonl"
+)
+
+// AuditRecord is a change to a setting of the live configuration: when it was
+// made and by whom, the old and new values, with secrets redacted, where the
+// new value came from and what applied it. Trigger is "reload" for a change
+// to the configuration file or a call to Reload, "env" for a change to the
+// environment, "set" for Set and Persist and "edit" for EditSettings. FileHash
+// is the hash of the configuration file a reload or edit applied.
+type AuditRecord struct {
+	Time     time.Time   `json:"time"`
+	User     string      `json:"user"`
+	Path     string      `json:"path"`
+	Old      interface{} `json:"old"`
+	New      interface{} `json:"new"`
+	Source   string      `json:"source"`
+	Trigger  string      `json:"trigger"`
+	File     string      `json:"file,omitempty"`
+	FileHash string      `json:"fileHash,omitempty"`
+}
+
+// ****** Audit ***************************************************************
+
+// audit records the changes applied by trigger through the Logger, or the
+// standard log, and in the audit file when there is one.
+func (c *Configuration) audit(diff Diff, trigger string) {
+	if len(diff) == 0 || !c.Metadata.audit {
+		return
+	}
+	now := time.Now()
+	c.lock.Lock()
+	records := make([]AuditRecord, 0, len(diff))
+	for _, change := range diff {
+		record := AuditRecord{
+			Time:    now,
+			User:    c.Metadata.userName,
+			Path:    change.Path,
+			Old:     change.Old,
+			New:     change.New,
+			Trigger: trigger,
+			File:    c.Metadata.configFile,
+		}
+		if change.Secret {
+			record.Old, record.New = change.redact(change.Old), change.redact(change.New)
+		}
+		if s := c.setting(change.Path); s != nil {
+			record.Source = s.source
+		}
+		if trigger != auditSet && trigger != auditEnv && c.fileHash != [sha256.Size]byte{} {
+			record.FileHash = fmt.Sprintf("%x", c.fileHash)
+		}
+		records = append(records, record)
+	}
+	c.lock.Unlock()
+
+	for i, record := range records {
+		message := fmt.Sprintf("configuration changed: %s (%s, %s by %s)", diff[i], record.Source, record.Trigger, record.User)
+		if c.Metadata.logger != nil {
+			c.Metadata.logger.Info(message)
+		} else {
+			log.Println(message)
+		}
+	}
+	if c.Metadata.auditFile != "" {
+		if err := c.writeAudit(records); err != nil {
+			c.notifyError(err)
+		}
+	}
+}
+
+// writeAudit appends the records to the audit file, one JSON object a line.
+// A relative file is in the state directory.
+func (c *Configuration) writeAudit(records []AuditRecord) error {
+	c.auditLock.Lock()
+	defer c.auditLock.Unlock()
+
+	file := c.Metadata.auditFile
+	if !filepath.IsAbs(file) {
+		dir, err := c.Metadata.StateDir()
+		if err != nil {
+			return &InvalidInitConfigError{Code: ErrAuditCoreConfig, err: err}
+		}
+		file = filepath.Join(dir, file)
+	}
+	var bs []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return &InvalidInitConfigError{Code: ErrAuditCoreConfig, File: file, Path: record.Path, err: err}
+		}
+		bs = append(append(bs, line...), '\n')
+	}
+	if err := appendFile(c.Metadata.fileSystem, file, bs); err != nil {
+		return &InvalidInitConfigError{Code: ErrAuditCoreConfig, File: file, err: err}
+	}
+	return nil
+}
+
+// appendFileSystem is a FileSystem that can append to a file without
+// rewriting it, as the operating system's can.
+type appendFileSystem interface {
+	FileSystem
+	AppendFile(name string, data []byte) error
+}
+
+// appendFile appends data to the file, creating it if needed. A file system
+// that cannot append has the file rewritten with data added.
+func appendFile(fsys FileSystem, name string, data []byte) error {
+	if a, ok := fsys.(appendFileSystem); ok {
+		return a.AppendFile(name, data)
+	}
+	bs, err := fsys.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return fsys.WriteFile(name, append(bs, data...))
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionAudit logs every change to the live configuration, with
+// who made it, the old and new values and where the new value came from,
+// through the ConfigurationOptionLogger Logger or the standard log.
+func ConfigurationOptionAudit() ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.audit = true
+		return nil
+	}
+}
+
+// ConfigurationOptionAuditFile audits changes as ConfigurationOptionAudit
+// does, and also appends an AuditRecord for each to file as a line of JSON. A
+// relative file is in the state directory; an empty one is audit.jsonl there.
+func ConfigurationOptionAuditFile(file string) ConfigurationOption {
+	return func(c *Configuration) error {
+		if file == "" {
+			file = auditName
+		}
+		c.Metadata.audit = true
+		c.Metadata.auditFile = file
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type auditConfig struct {
+	Name     string         `yaml:"name"`
+	Port     int            `yaml:"port" env:"AUDIT_PORT" default:"8080"`
+	Password string         `yaml:"password" secret:""`
+	Core     *Configuration `yaml:"core"`
+}
+
+// readAudit returns the records in the audit file.
+func readAudit(t *testing.T, file string) []AuditRecord {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func Test_Audit(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\npassword: hunter2\n")
+	state := t.TempDir()
+	env := mapEnv{}
+	logger, _ := NewLogger()
+	config := &auditConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(env),
+		ConfigurationOptionStateDir(state),
+		ConfigurationOptionAuditFile(""),
+		ConfigurationOptionLogger(logger),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, config.Core.Set("port", "9100"))
+	assert.NoError(t, config.Core.Set("port", "9100"))
+	assert.NoError(t, config.Core.Set("password", "s3cret"))
+	content := "name: prod\npassword: hunter2\n"
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	assert.NoError(t, config.Core.Reload(context.Background()))
+	assert.NoError(t, config.Core.Setenv("AUDIT_PORT", "9200"))
+
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	records := readAudit(t, filepath.Join(state, "audit.jsonl"))
+	type entry struct {
+		path, source, trigger string
+		old, new              interface{}
+	}
+	var entries []entry
+	for _, record := range records {
+		assert.False(t, record.Time.IsZero())
+		assert.NotEmpty(t, record.User)
+		assert.Equal(t, file, record.File)
+		entries = append(entries, entry{record.Path, record.Source, record.Trigger, record.Old, record.New})
+	}
+	// Setting a value it already has is not a change. The reload restores
+	// the values of the file, and the environment overrides the port.
+	assert.Equal(t, []entry{
+		{"port", "set", "set", float64(8080), float64(9100)},
+		{"password", "set", "set", "******", "******"},
+		{"name", "file", "reload", "demo", "prod"},
+		{"port", "default", "reload", float64(9100), float64(8080)},
+		{"password", "file", "reload", "******", "******"},
+		{"port", "env", "env", float64(8080), float64(9200)},
+	}, entries)
+	if assert.Len(t, records, 6) {
+		// Only a reload applies the content of the file.
+		assert.Equal(t, hash, records[2].FileHash)
+		assert.Empty(t, records[0].FileHash)
+		assert.Empty(t, records[5].FileHash)
+	}
+
+	assert.Equal(t, []string{
+		"configuration changed: ~ port: 8080 -> 9100 (set, set by " + records[0].User + ")",
+		"configuration changed: ~ password: ****** -> ****** (set, set by " + records[0].User + ")",
+		"configuration changed: ~ name: demo -> prod (file, reload by " + records[0].User + ")",
+		"configuration changed: ~ port: 9100 -> 8080 (default, reload by " + records[0].User + ")",
+		"configuration changed: ~ password: ****** -> ****** (file, reload by " + records[0].User + ")",
+		"configuration changed: ~ port: 8080 -> 9200 (env, env by " + records[0].User + ")",
+	}, warnings(logger))
+}
+
+func Test_AuditFileError(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	var errs []error
+	config := &auditConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+		ConfigurationOptionAuditFile(filepath.Join(t.TempDir(), "missing", "audit.jsonl")),
+		ConfigurationOptionErrorNotify(func(err error) { errs = append(errs, err) }),
+	)
+	assert.NoError(t, err)
+
+	// The change is made, and the failure to record it reported.
+	assert.NoError(t, config.Core.Set("port", "9100"))
+	assert.Equal(t, 9100, config.Port)
+	if assert.Len(t, errs, 1) {
+		assert.ErrorIs(t, errs[0], ErrAuditCoreConfig)
+		assert.ErrorIs(t, errs[0], os.ErrNotExist)
+	}
+}
+
+func Test_AuditLogger(t *testing.T) {
+	for name, options := range map[string][]ConfigurationOption{
+		"Audited":     {ConfigurationOptionAudit()},
+		"Not audited": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := writeManaged(t, "config.yaml", "name: demo\n")
+			logger, _ := NewLogger()
+			config := &auditConfig{}
+			err := InitConfig(context.Background(), config, append([]ConfigurationOption{
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(file),
+				ConfigurationOptionEnvironment(mapEnv{}),
+				ConfigurationOptionStateDir(t.TempDir()),
+				ConfigurationOptionLogger(logger),
+			}, options...)...)
+			assert.NoError(t, err)
+
+			assert.NoError(t, config.Core.Set("name", "prod"))
+			if options == nil {
+				assert.Empty(t, warnings(logger))
+				return
+			}
+			assert.Equal(t, []string{"configuration changed: ~ name: demo -> prod (set, set by " + config.Core.Metadata.userName + ")"}, warnings(logger))
+			assert.NoFileExists(t, filepath.Join(config.Core.Metadata.stateDir, "audit.jsonl"))
+		})
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+// Package cliftest provides an in-memory file system, environment and clock
+// for testing code that uses clif.InitConfig, and helpers to check the
+// notifications a configuration sends.
+package cliftest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jfigge/clif"
+)
+
+// Timeout is how long the assertions wait for a notification or error sent
+// from the configuration's watcher goroutine.
+var Timeout = 2 * time.Second
+
+// Harness holds the fakes a configuration is initialized with. The watcher
+// goroutine is stopped when the test ends.
+type Harness struct {
+	FS    *FS
+	Env   *Env
+	Clock *Clock
+
+	t      testing.TB
+	ctx    context.Context
+	wg     *sync.WaitGroup
+	lock   sync.Mutex
+	errors []error
+	signal chan struct{}
+}
+
+// Notification is a single call of a clif.ConfigurationNotifyFunc.
+type Notification struct {
+	Setting string
+	Value   interface{}
+}
+
+// Recorder records the notifications sent for a set of settings.
+type Recorder struct {
+	lock          sync.Mutex
+	notifications []Notification
+	signal        chan struct{}
+}
+
+// ****** Harness *************************************************************
+
+// New returns a harness with an empty file system and environment and a
+// clock stopped at the current time.
+func New(t testing.TB) *Harness {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Harness{
+		FS:     NewFS(nil),
+		Env:    NewEnv(nil),
+		Clock:  NewClock(time.Now()),
+		t:      t,
+		ctx:    ctx,
+		wg:     &sync.WaitGroup{},
+		signal: make(chan struct{}, 1),
+	}
+	t.Cleanup(func() {
+		cancel()
+		h.wg.Wait()
+	})
+	return h
+}
+
+// Options returns the options that make a configuration use the harness.
+func (h *Harness) Options() []clif.ConfigurationOption {
+	return []clif.ConfigurationOption{
+		clif.ConfigurationOptionFileSystem(h.FS),
+		clif.ConfigurationOptionEnvironment(h.Env),
+		clif.ConfigurationOptionClock(h.Clock),
+		clif.ConfigurationOptionWaitGroup(h.wg),
+		clif.ConfigurationOptionErrorNotify(h.notifyError),
+	}
+}
+
+// Init calls clif.InitConfig with the harness options followed by options.
+// When it succeeds, Init returns once the watcher is running.
+func (h *Harness) Init(config interface{}, options ...clif.ConfigurationOption) error {
+	var core *clif.Configuration
+	options = append(append(h.Options(), options...), func(c *clif.Configuration) error {
+		core = c
+		return nil
+	})
+	if err := clif.InitConfig(h.ctx, config, options...); err != nil {
+		return err
+	}
+	// The watcher only creates a ticker when it polls the environment.
+	if core.Metadata.EnvInterval() > 0 {
+		h.Clock.BlockUntil(1)
+	}
+	return nil
+}
+
+// Tick advances the clock by d, firing the watcher's periodic checks.
+func (h *Harness) Tick(d time.Duration) {
+	h.Clock.Advance(d)
+}
+
+// Errors returns the errors reported by the watcher so far.
+func (h *Harness) Errors() []error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]error{}, h.errors...)
+}
+
+// AssertError waits for the watcher to report an error whose message
+// contains text.
+func (h *Harness) AssertError(t testing.TB, text string) bool {
+	t.Helper()
+	ok := waitFor(h.signal, func() bool {
+		for _, err := range h.Errors() {
+			if strings.Contains(err.Error(), text) {
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		t.Errorf("no error containing %q, got %v", text, h.Errors())
+	}
+	return ok
+}
+
+func (h *Harness) notifyError(err error) {
+	h.lock.Lock()
+	h.errors = append(h.errors, err)
+	h.lock.Unlock()
+	select {
+	case h.signal <- struct{}{}:
+	default:
+	}
+}
+
+// ****** Notifications *******************************************************
+
+// NewRecorder records the notifications c sends for the settings.
+func NewRecorder(c *clif.Configuration, settings ...string) *Recorder {
+	r := &Recorder{signal: make(chan struct{}, 1)}
+	for _, setting := range settings {
+		c.AddNotifyOnChange(setting, r.record)
+	}
+	return r
+}
+
+// Notifications returns the notifications recorded so far, in order.
+func (r *Recorder) Notifications() []Notification {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Notification{}, r.notifications...)
+}
+
+// Reset forgets the notifications recorded so far.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.notifications = nil
+}
+
+// AssertNotified waits for a notification of setting with value.
+func (r *Recorder) AssertNotified(t testing.TB, setting string, value interface{}) bool {
+	t.Helper()
+	ok := waitFor(r.signal, func() bool {
+		for _, n := range r.Notifications() {
+			if n.Setting == setting && reflect.DeepEqual(n.Value, value) {
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		t.Errorf("no notification of %s = %v, got %s", setting, value, r)
+	}
+	return ok
+}
+
+// AssertNotNotified checks that no notification of setting was recorded.
+func (r *Recorder) AssertNotNotified(t testing.TB, setting string) bool {
+	t.Helper()
+	for _, n := range r.Notifications() {
+		if n.Setting == setting {
+			t.Errorf("unexpected notification of %s = %v", setting, n.Value)
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Recorder) String() string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i, n := range r.Notifications() {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(fmt.Sprintf("%s = %v", n.Setting, n.Value))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+func (r *Recorder) record(setting string, value interface{}) {
+	r.lock.Lock()
+	r.notifications = append(r.notifications, Notification{Setting: setting, Value: value})
+	r.lock.Unlock()
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+}
+
+// waitFor checks cond each time signal fires until it holds or Timeout passes.
+func waitFor(signal chan struct{}, cond func() bool) bool {
+	timeout := time.After(Timeout)
+	for !cond() {
+		select {
+		case <-signal:
+		case <-timeout:
+			return cond()
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cliftest
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jfigge/clif"
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfig struct {
+	Name string              `yaml:"name" env:"TEST_NAME"`
+	Port int                 `yaml:"port" default:"8080"`
+	Core *clif.Configuration `yaml:"core"`
+}
+
+func Test_HarnessReload(t *testing.T) {
+	h := New(t)
+	assert.NoError(t, h.FS.WriteFile("config.yaml", []byte("name: demo\nport: 9000\n")))
+	h.Env.Setenv("TEST_NAME", "from-env")
+
+	config := &testConfig{}
+	if !assert.NoError(t, h.Init(config, clif.ConfigurationOptionConfigFile("config.yaml"))) {
+		return
+	}
+	assert.Equal(t, "from-env", config.Name)
+	assert.Equal(t, 9000, config.Port)
+	assert.True(t, h.FS.Watched("config.yaml"))
+
+	r := NewRecorder(config.Core, "port")
+	assert.NoError(t, h.FS.WriteFile("config.yaml", []byte("name: demo\nport: 9001\n")))
+	r.AssertNotified(t, "port", 9001)
+
+	assert.NoError(t, h.FS.WriteFile("config.yaml", []byte("port: [\n")))
+	h.AssertError(t, "did not find expected node content")
+
+	h.FS.WatchError("config.yaml", errors.New("device gone"))
+	h.AssertError(t, "device gone")
+	assert.Equal(t, []Notification{{Setting: "port", Value: 9001}}, r.Notifications())
+}
+
+func Test_HarnessEnvPolling(t *testing.T) {
+	h := New(t)
+	h.Env.Setenv("TEST_NAME", "first")
+	config := &testConfig{}
+	if !assert.NoError(t, h.Init(config, clif.ConfigurationOptionConfigFile(""), clif.ConfigurationOptionEnvInterval(time.Second))) {
+		return
+	}
+	r := NewRecorder(config.Core, "name")
+
+	// Unchanged variables notify nobody, however often they are checked.
+	h.Tick(time.Second)
+	h.Clock.BlockUntil(1)
+	h.Tick(time.Second)
+	h.Env.Setenv("TEST_NAME", "second")
+	h.Clock.BlockUntil(1)
+	h.Tick(time.Second)
+	r.AssertNotified(t, "name", "second")
+	h.Clock.BlockUntil(1)
+	h.Tick(time.Second)
+	h.Clock.BlockUntil(1)
+	assert.Equal(t, []Notification{{Setting: "name", Value: "second"}}, r.Notifications())
+
+	assert.NoError(t, config.Core.Setenv("TEST_NAME", "third"))
+	assert.Equal(t, "third", config.Name)
+	assert.Equal(t, Notification{Setting: "name", Value: "third"}, r.Notifications()[1])
+}
+
+func Test_HarnessNoEnvPolling(t *testing.T) {
+	h := New(t)
+	config := &testConfig{}
+	// Without polling there is no ticker to wait for.
+	if !assert.NoError(t, h.Init(config, clif.ConfigurationOptionConfigFile(""), clif.ConfigurationOptionEnvInterval(0))) {
+		return
+	}
+	assert.NoError(t, config.Core.Setenv("TEST_NAME", "set"))
+	assert.Equal(t, "set", config.Name)
+}
+
+func Test_HarnessWatchFile(t *testing.T) {
+	h := New(t)
+	assert.NoError(t, h.FS.WriteFile("allow.txt", []byte("alice")))
+	config := &testConfig{}
+	if !assert.NoError(t, h.Init(config, clif.ConfigurationOptionConfigFile(""))) {
+		return
+	}
+	delivered := make(chan string, 10)
+	err := config.Core.WatchFile("allow.txt", func(path string, data []byte) { delivered <- string(data) })
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", <-delivered)
+
+	// Nothing is delivered until the writes have settled for the debounce
+	// interval.
+	assert.NoError(t, h.FS.WriteFile("allow.txt", []byte("alice\nbob")))
+	h.Clock.BlockUntil(2)
+	assert.NoError(t, h.FS.WriteFile("allow.txt", []byte("alice\nbob\ncarol")))
+	h.Tick(50 * time.Millisecond)
+	select {
+	case data := <-delivered:
+		t.Fatalf("delivered %q before settling", data)
+	case <-time.After(20 * time.Millisecond):
+	}
+	h.Tick(100 * time.Millisecond)
+	select {
+	case data := <-delivered:
+		assert.Equal(t, "alice\nbob\ncarol", data)
+	case <-time.After(Timeout):
+		t.Fatal("change not delivered")
+	}
+
+	h.FS.WatchError("allow.txt", errors.New("device gone"))
+	h.AssertError(t, "device gone")
+}
+
+func Test_HarnessAudit(t *testing.T) {
+	h := New(t)
+	config := &testConfig{}
+	err := h.Init(config, clif.ConfigurationOptionConfigFile(""), clif.ConfigurationOptionAuditFile("/state/audit.jsonl"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// The audit file is written to the harness file system.
+	assert.NoError(t, config.Core.Set("port", "9000"))
+	assert.NoError(t, config.Core.Set("port", "9001"))
+	bs, err := h.FS.ReadFile("/state/audit.jsonl")
+	if assert.NoError(t, err) {
+		lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.Contains(t, lines[1], `"new":9001`)
+		}
+	}
+	assert.Empty(t, h.Errors())
+}
+
+func Test_FS(t *testing.T) {
+	f := NewFS(map[string]string{"dir/a.yaml": "a: 1\n"})
+	bs, err := f.ReadFile("dir/./a.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1\n", string(bs))
+
+	info, err := f.Stat("dir/a.yaml")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a.yaml", info.Name())
+		assert.Equal(t, int64(5), info.Size())
+	}
+
+	w, err := f.Watch("dir/a.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, f.WriteFile("dir/a.yaml", []byte("a: 2\n")))
+	select {
+	case <-w.Changes():
+	default:
+		t.Fatal("change not delivered")
+	}
+	assert.NoError(t, w.Close())
+	_, ok := <-w.Changes()
+	assert.False(t, ok)
+	assert.False(t, f.Watched("dir/a.yaml"))
+
+	assert.NoError(t, f.Remove("dir/a.yaml"))
+	_, err = f.ReadFile("dir/a.yaml")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorIs(t, f.Remove("dir/a.yaml"), fs.ErrNotExist)
+}
+
+func Test_Clock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+	ticker := c.NewTicker(5 * time.Second)
+	c.BlockUntil(1)
+
+	c.Advance(4 * time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("early tick")
+	default:
+	}
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(5*time.Second), <-ticker.C())
+
+	ticker.Stop()
+	c.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Fatal("tick after stop")
+	default:
+	}
+	ticker.Reset(time.Second)
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(66*time.Second), <-ticker.C())
+	assert.Equal(t, start.Add(66*time.Second), c.Now())
+}
+
+func Test_Env(t *testing.T) {
+	e := NewEnv(map[string]string{"A": "1"})
+	v, ok := e.LookupEnv("A")
+	assert.True(t, ok)
+	assert.Equal(t, "1", v)
+	e.Unsetenv("A")
+	_, ok = e.LookupEnv("A")
+	assert.False(t, ok)
+}
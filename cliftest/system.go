@@ -0,0 +1,300 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package cliftest
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jfigge/clif"
+)
+
+// FS is an in-memory clif.FileSystem. Files written through it are seen by
+// its watchers straight away.
+type FS struct {
+	lock     sync.Mutex
+	files    map[string]*memFile
+	watchers map[string][]*memWatcher
+	now      func() time.Time
+}
+
+// Env is an in-memory clif.Environment.
+type Env struct {
+	lock sync.Mutex
+	vars map[string]string
+}
+
+// Clock is a clif.Clock whose time only moves when Advance is called.
+type Clock struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	tickers []*ticker
+}
+
+type memFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+type memWatcher struct {
+	fs      *FS
+	name    string
+	changes chan struct{}
+	errors  chan error
+	once    sync.Once
+}
+type ticker struct {
+	clock  *Clock
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+	active bool
+}
+
+// ****** File system *********************************************************
+
+// NewFS returns a file system holding files, keyed by name.
+func NewFS(files map[string]string) *FS {
+	f := &FS{
+		files:    make(map[string]*memFile),
+		watchers: make(map[string][]*memWatcher),
+		now:      time.Now,
+	}
+	for name, data := range files {
+		f.files[filepath.Clean(name)] = &memFile{name: filepath.Base(name), data: []byte(data), modTime: f.now()}
+	}
+	return f
+}
+
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	file, ok := f.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte{}, file.data...), nil
+}
+
+// WriteFile replaces the file and tells its watchers it changed.
+func (f *FS) WriteFile(name string, data []byte) error {
+	f.lock.Lock()
+	name = filepath.Clean(name)
+	f.files[name] = &memFile{name: filepath.Base(name), data: append([]byte{}, data...), modTime: f.now()}
+	watchers := append([]*memWatcher{}, f.watchers[name]...)
+	f.lock.Unlock()
+
+	for _, w := range watchers {
+		select {
+		case w.changes <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Remove deletes the file. As with a real file system, watchers are not told.
+func (f *FS) Remove(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := f.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(f.files, name)
+	return nil
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	file, ok := f.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+func (f *FS) Watch(name string) (clif.FileWatcher, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &memWatcher{
+		fs:      f,
+		name:    filepath.Clean(name),
+		changes: make(chan struct{}, 1),
+		errors:  make(chan error, 1),
+	}
+	f.watchers[w.name] = append(f.watchers[w.name], w)
+	return w, nil
+}
+
+// WatchError delivers err to the watchers of the named file, as a file
+// system reporting a failure would.
+func (f *FS) WatchError(name string, err error) {
+	f.lock.Lock()
+	watchers := append([]*memWatcher{}, f.watchers[filepath.Clean(name)]...)
+	f.lock.Unlock()
+	for _, w := range watchers {
+		select {
+		case w.errors <- err:
+		default:
+		}
+	}
+}
+
+// Watched reports whether the named file has an open watcher.
+func (f *FS) Watched(name string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.watchers[filepath.Clean(name)]) > 0
+}
+
+func (w *memWatcher) Changes() <-chan struct{} {
+	return w.changes
+}
+func (w *memWatcher) Errors() <-chan error {
+	return w.errors
+}
+func (w *memWatcher) Close() error {
+	w.once.Do(func() {
+		w.fs.lock.Lock()
+		watchers := w.fs.watchers[w.name]
+		for i, other := range watchers {
+			if other == w {
+				w.fs.watchers[w.name] = append(watchers[:i:i], watchers[i+1:]...)
+				break
+			}
+		}
+		w.fs.lock.Unlock()
+		close(w.changes)
+		close(w.errors)
+	})
+	return nil
+}
+
+func (m *memFile) Name() string       { return m.name }
+func (m *memFile) Size() int64        { return int64(len(m.data)) }
+func (m *memFile) Mode() fs.FileMode  { return 0o600 }
+func (m *memFile) ModTime() time.Time { return m.modTime }
+func (m *memFile) IsDir() bool        { return false }
+func (m *memFile) Sys() interface{}   { return nil }
+
+// ****** Environment *********************************************************
+
+// NewEnv returns an environment holding vars.
+func NewEnv(vars map[string]string) *Env {
+	e := &Env{vars: make(map[string]string)}
+	for key, value := range vars {
+		e.vars[key] = value
+	}
+	return e
+}
+
+func (e *Env) LookupEnv(key string) (string, bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	value, ok := e.vars[key]
+	return value, ok
+}
+
+// Setenv sets a variable, as os.Setenv does. It lets Configuration.Setenv
+// change the environment.
+func (e *Env) Setenv(key string, value string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.vars[key] = value
+	return nil
+}
+
+// Unsetenv removes a variable, as os.Unsetenv does.
+func (e *Env) Unsetenv(key string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.vars, key)
+	return nil
+}
+
+// ****** Clock ***************************************************************
+
+// NewClock returns a clock stopped at now.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *Clock) NewTicker(d time.Duration) clif.Ticker {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &ticker{clock: c, c: make(chan time.Time, 1), period: d, next: c.now.Add(d), active: true}
+	c.tickers = append(c.tickers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, firing every ticker that falls due.
+// Like a time.Ticker, a ticker whose last tick was not yet received drops
+// the ones that follow.
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if !t.active || t.next.After(c.now) {
+			continue
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// BlockUntil waits until n tickers are running, so that an Advance is not
+// missed by a goroutine that has yet to create its ticker.
+func (c *Clock) BlockUntil(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.active() < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *Clock) active() int {
+	n := 0
+	for _, t := range c.tickers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *ticker) C() <-chan time.Time {
+	return t.c
+}
+func (t *ticker) Reset(d time.Duration) {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.period, t.next, t.active = d, t.clock.now.Add(d), true
+	t.clock.cond.Broadcast()
+}
+func (t *ticker) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.active = false
+}
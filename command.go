@@ -0,0 +1,244 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type CommandRunFunc func(ctx context.Context, cmd *Command, args []string) error
+type CommandArgsFunc func(args []string) error
+
+// Command is a node in a command tree. Config and PersistentConfig are
+// pointers to structs whose fields are bound with the same tags used by
+// InitConfig. Flags from PersistentConfig are also accepted by every
+// command below this one.
+type Command struct {
+	Name             string
+	Aliases          []string
+	Description      string
+	Usage            string
+	Args             CommandArgsFunc
+	Config           interface{}
+	PersistentConfig interface{}
+	Run              CommandRunFunc
+	Hidden           bool
+
+	parent        *Command
+	commands      []*Command
+	configuration *Configuration
+	lenient       bool
+}
+type commandBinding struct {
+	command    *Command
+	config     interface{}
+	prefix     string
+	persistent bool
+}
+
+// ****** Construction ********************************************************
+
+// AddCommand adds sub-commands to the command and returns it for chaining.
+func (cmd *Command) AddCommand(commands ...*Command) *Command {
+	for _, sub := range commands {
+		sub.parent = cmd
+		cmd.commands = append(cmd.commands, sub)
+	}
+	return cmd
+}
+
+// Execute loads the configuration from args, selects the command named by
+// the leading positional arguments and runs it with the remainder. Requests
+// for help, shell completion or the version are answered without running a
+// command.
+func (cmd *Command) Execute(ctx context.Context, config interface{}, args []string, options ...ConfigurationOption) error {
+	var c *Configuration
+	options = append(options, ConfigurationOptionArgs(args), configurationOptionCommand(cmd, &c))
+	if err := InitConfig(ctx, config, options...); err != nil {
+		if errors.Is(err, ErrHelpRequested) || errors.Is(err, ErrCompletionRequested) || errors.Is(err, ErrVersionRequested) {
+			return nil
+		}
+		return err
+	}
+
+	selected := c.command
+	if selected.Run == nil {
+		return c.Usage(c.Metadata.output)
+	}
+	if selected.Args != nil {
+		if err := selected.Args(c.args); err != nil {
+			e := &InvalidInitConfigError{Code: ErrCommandCoreConfig, Path: selected.CommandPath(), err: err}
+			if len(c.args) > 0 {
+				e.err = suggestCommand(err, c.args[0], selected)
+			}
+			return e
+		}
+	}
+	return selected.Run(ctx, selected, c.args)
+}
+
+// ****** Command functions ***************************************************
+
+// CommandPath returns the names of the command and its parents, separated by
+// spaces, as typed on the command line.
+func (cmd *Command) CommandPath() string {
+	if cmd.parent == nil {
+		return cmd.Name
+	}
+	return cmd.parent.CommandPath() + " " + cmd.Name
+}
+func (cmd *Command) Parent() *Command {
+	return cmd.parent
+}
+func (cmd *Command) Commands() []*Command {
+	return cmd.commands
+}
+
+// Configuration returns the core configuration the command was executed with.
+func (cmd *Command) Configuration() *Configuration {
+	for command := cmd; command != nil; command = command.parent {
+		if command.configuration != nil {
+			return command.configuration
+		}
+	}
+	return nil
+}
+
+func (cmd *Command) find(name string) *Command {
+	for _, sub := range cmd.commands {
+		if sub.Name == name {
+			return sub
+		}
+		for _, alias := range sub.Aliases {
+			if alias == name {
+				return sub
+			}
+		}
+	}
+	return nil
+}
+
+// lenient reports whether the selected command repairs or reports on the
+// configuration file, and so must run even when the file fails to load.
+func (c *Configuration) lenient() bool {
+	return c.command != nil && c.command.lenient
+}
+
+func (cmd *Command) bindingPrefix() string {
+	return joinPath("commands", strings.ReplaceAll(cmd.CommandPath(), " ", "."))
+}
+
+// bindCommand makes cmd the selected command and collects the settings of its
+// configuration structs so their flags are recognized.
+func (c *Configuration) bindCommand(cmd *Command) error {
+	c.command = cmd
+	cmd.configuration = c
+	for _, b := range []*commandBinding{
+		{command: cmd, config: cmd.PersistentConfig, prefix: cmd.bindingPrefix(), persistent: true},
+		{command: cmd, config: cmd.Config, prefix: cmd.bindingPrefix()},
+	} {
+		if b.config == nil {
+			continue
+		}
+		c.bindings = append(c.bindings, b)
+		if err := c.walkBinding(b, c.collectSetting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Configuration) walkBinding(b *commandBinding, fs ...processFunc) error {
+	c.binding = b
+	defer func() { c.binding = nil }()
+	return walkStructure(b.config, 0, b.prefix, fs...)
+}
+
+func (c *Configuration) unknownCommand(name string) error {
+	err := suggestCommand(fmt.Errorf("unknown command %q", name), name, c.command)
+	return &InvalidInitConfigError{Code: ErrCommandCoreConfig, Path: c.command.CommandPath(), err: err}
+}
+
+// ****** Suggestions *********************************************************
+
+func suggestCommand(err error, name string, cmd *Command) error {
+	var suggestions []string
+	for _, sub := range cmd.commands {
+		if sub.Hidden {
+			continue
+		}
+		for _, candidate := range append([]string{sub.Name}, sub.Aliases...) {
+			if strings.HasPrefix(candidate, name) || levenshtein(name, candidate) <= 2 {
+				suggestions = append(suggestions, sub.Name)
+				break
+			}
+		}
+	}
+	if len(suggestions) == 0 {
+		return err
+	}
+	sort.Strings(suggestions)
+	return fmt.Errorf("%w, did you mean %s?", err, strings.Join(suggestions, " or "))
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// ****** Arguments ***********************************************************
+
+func CommandArgsNone() CommandArgsFunc {
+	return CommandArgsRange(0, 0)
+}
+func CommandArgsExact(n int) CommandArgsFunc {
+	return CommandArgsRange(n, n)
+}
+func CommandArgsMin(n int) CommandArgsFunc {
+	return CommandArgsRange(n, -1)
+}
+func CommandArgsRange(minimum, maximum int) CommandArgsFunc {
+	return func(args []string) error {
+		switch {
+		case maximum == 0 && len(args) > 0:
+			return fmt.Errorf("unexpected argument %q", args[0])
+		case len(args) < minimum:
+			return fmt.Errorf("requires at least %d argument(s), received %d", minimum, len(args))
+		case maximum >= 0 && len(args) > maximum:
+			return fmt.Errorf("accepts at most %d argument(s), received %d", maximum, len(args))
+		}
+		return nil
+	}
+}
+
+// ****** Options *************************************************************
+
+func configurationOptionCommand(cmd *Command, configuration **Configuration) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.rootCommand = cmd
+		*configuration = c
+		return nil
+	}
+}
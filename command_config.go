@@ -0,0 +1,223 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// NewConfigCommand returns a "config" command whose sub-commands inspect,
+// change and validate the configuration file. Add it to an application's
+// root command.
+func NewConfigCommand() *Command {
+	config := &Command{Name: "config", Description: "Inspect and change the configuration"}
+	return config.AddCommand(
+		&Command{
+			Name:        "path",
+			Description: "Show the configuration file",
+			Args:        CommandArgsNone(),
+			Run:         configPath,
+			lenient:     true,
+		},
+		&Command{
+			Name:        "get",
+			Usage:       "<key>",
+			Description: "Show the value of a setting, or of every setting below a key",
+			Args:        CommandArgsExact(1),
+			Run:         configGet,
+		},
+		&Command{
+			Name:        "set",
+			Usage:       "<key> <value>",
+			Description: "Change a setting and save it to the configuration file",
+			Args:        CommandArgsExact(2),
+			Run:         configSet,
+		},
+		&Command{
+			Name:        "list",
+			Description: "List every setting with its value and source",
+			Args:        CommandArgsNone(),
+			Run:         configList,
+		},
+		&Command{
+			Name:        "edit",
+			Description: "Open the configuration file in $EDITOR and validate the result",
+			Args:        CommandArgsNone(),
+			Run:         configEdit,
+			lenient:     true,
+		},
+		&Command{
+			Name:        "ui",
+			Description: "Edit the settings in a full-screen editor",
+			Args:        CommandArgsNone(),
+			Run:         configUI,
+		},
+		&Command{
+			Name:        "validate",
+			Usage:       "[file]",
+			Description: "Check a configuration file for errors",
+			Args:        CommandArgsRange(0, 1),
+			Run:         configValidate,
+			lenient:     true,
+		},
+		&Command{
+			Name:        "diff",
+			Usage:       "<file> [file]",
+			Description: "Compare two configuration files, or one with the effective configuration",
+			Args:        CommandArgsRange(1, 2),
+			Run:         configDiff,
+			lenient:     true,
+		},
+	)
+}
+
+// ****** Commands ************************************************************
+
+func configPath(ctx context.Context, cmd *Command, args []string) error {
+	c := cmd.Configuration()
+	file, err := filepath.Abs(c.Metadata.configFile)
+	if err != nil {
+		return err
+	}
+	if _, err = c.Metadata.fileSystem.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		file += " (not found)"
+	}
+	_, err = fmt.Fprintln(c.Metadata.output, file)
+	return err
+}
+
+func configGet(ctx context.Context, cmd *Command, args []string) error {
+	c := cmd.Configuration()
+	if s := c.setting(args[0]); s != nil && s.command == nil {
+		_, err := fmt.Fprintln(c.Metadata.output, s.display())
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.Metadata.output, 0, 4, 2, ' ', 0)
+	found := false
+	for _, s := range c.settings {
+		if s.command == nil && strings.HasPrefix(s.path, args[0]+".") {
+			found = true
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", s.path, s.display())
+		}
+	}
+	if !found {
+		return &InvalidInitConfigError{Code: ErrUnknownKeyCoreConfig, Path: args[0], err: fmt.Errorf("unknown setting")}
+	}
+	return w.Flush()
+}
+
+func configSet(ctx context.Context, cmd *Command, args []string) error {
+	c := cmd.Configuration()
+	if s := c.setting(args[0]); s == nil || s.command != nil {
+		return &InvalidInitConfigError{Code: ErrUnknownKeyCoreConfig, Path: args[0], err: fmt.Errorf("unknown setting")}
+	}
+	return c.Persist(args[0], args[1])
+}
+
+func configList(ctx context.Context, cmd *Command, args []string) error {
+	c := cmd.Configuration()
+	w := tabwriter.NewWriter(c.Metadata.output, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, s := range c.settings {
+		if s.command != nil {
+			continue
+		}
+		source := s.source
+		if source == "" {
+			source = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", s.path, s.display(), source)
+	}
+	return w.Flush()
+}
+
+func configEdit(ctx context.Context, cmd *Command, args []string) error {
+	c := cmd.Configuration()
+	file := c.Metadata.configFile
+	if _, err := c.Metadata.fileSystem.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		if err = c.Metadata.fileSystem.WriteFile(file, nil); err != nil {
+			return err
+		}
+	}
+
+	var editor []string
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if value, ok := c.Metadata.environment.LookupEnv(name); ok && len(editor) == 0 {
+			editor = strings.Fields(value)
+		}
+	}
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	edit := exec.CommandContext(ctx, editor[0], append(editor[1:], file)...)
+	edit.Stdin, edit.Stdout, edit.Stderr = c.Metadata.input, c.Metadata.output, c.Metadata.output
+	if err := edit.Run(); err != nil {
+		return fmt.Errorf("%s: %w", editor[0], err)
+	}
+	return c.reportValidation(c.Metadata.output, file)
+}
+
+func configUI(ctx context.Context, cmd *Command, args []string) error {
+	return cmd.Configuration().EditSettings(ctx)
+}
+
+func configValidate(ctx context.Context, cmd *Command, args []string) error {
+	c := cmd.Configuration()
+	file := c.Metadata.configFile
+	if len(args) > 0 {
+		file = args[0]
+	}
+	return c.reportValidation(c.Metadata.output, file)
+}
+
+func configDiff(ctx context.Context, cmd *Command, args []string) error {
+	c := cmd.Configuration()
+	var diff Diff
+	var err error
+	if len(args) == 2 {
+		diff, err = c.DiffFiles(args[0], args[1])
+	} else {
+		diff, err = c.DiffEffective(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if len(diff) == 0 {
+		_, err = fmt.Fprintln(c.Metadata.output, "no differences")
+		return err
+	}
+	_, err = fmt.Fprintln(c.Metadata.output, diff)
+	return err
+}
+
+// ****** Support *************************************************************
+
+func (c *Configuration) reportValidation(w io.Writer, file string) error {
+	if err := c.validateFile(file); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s: valid\n", file)
+	return err
+}
+
+// validateFile loads a file into a fresh instance of the configuration type,
+// applying defaults and validation rules, without touching the live values.
+func (c *Configuration) validateFile(file string) error {
+	bs, err := c.Metadata.fileSystem.ReadFile(file)
+	if err != nil {
+		return &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
+	}
+	_, err = c.loadInstance(file, bs, false)
+	return err
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type managedConfig struct {
+	Name     string         `yaml:"name" validate:"required"`
+	Port     int            `yaml:"port" default:"8080" validate:"min=1024"`
+	Password string         `yaml:"password" secret:""`
+	Core     *Configuration `yaml:"core"`
+}
+
+const managedYAML = `# service settings
+name: demo # the service name
+port: 9000
+password: hunter2
+`
+
+func runConfigCommand(t *testing.T, file string, args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	root := (&Command{Name: "demo"}).AddCommand(NewConfigCommand())
+	err := root.Execute(
+		context.Background(), &managedConfig{}, append([]string{"config"}, args...),
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionOutput(out),
+	)
+	return out.String(), err
+}
+
+func writeManaged(t *testing.T, name string, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func Test_ConfigCommandRead(t *testing.T) {
+	file := writeManaged(t, "config.yaml", managedYAML)
+
+	out, err := runConfigCommand(t, file, "path")
+	assert.NoError(t, err)
+	assert.Equal(t, file+"\n", out)
+
+	out, err = runConfigCommand(t, file, "get", "port")
+	assert.NoError(t, err)
+	assert.Equal(t, "9000\n", out)
+
+	out, err = runConfigCommand(t, file, "get", "core.logger")
+	assert.NoError(t, err)
+	assert.Equal(t, "core.logger.level      info\ncore.logger.colorized  false\n", out)
+
+	_, err = runConfigCommand(t, file, "get", "missing")
+	if assert.Error(t, err) {
+		assert.Equal(t, "missing: unknown setting", err.Error())
+	}
+
+	out, err = runConfigCommand(t, file, "list")
+	assert.NoError(t, err)
+	assert.Equal(t, `KEY                    VALUE   SOURCE
+name                   demo    file
+port                   9000    file
+password               ******  file
+core.logger.level      info    default
+core.logger.colorized  false   -
+core.console.width     0       -
+core.console.height    0       -
+`, out)
+}
+
+func Test_ConfigCommandSet(t *testing.T) {
+	file := writeManaged(t, "config.yaml", managedYAML)
+	_, err := runConfigCommand(t, file, "set", "port", "9443")
+	assert.NoError(t, err)
+	_, err = runConfigCommand(t, file, "set", "core.logger.level", "debug")
+	assert.NoError(t, err)
+	bs, _ := os.ReadFile(file)
+	assert.Equal(t, `# service settings
+name: demo # the service name
+port: 9443
+password: hunter2
+core:
+  logger:
+    level: debug
+`, string(bs))
+
+	_, err = runConfigCommand(t, file, "set", "port", "80")
+	if assert.Error(t, err) {
+		assert.Equal(t, "port: must be at least 1024", err.Error())
+	}
+
+	file = writeManaged(t, "config.json", `{"name": "demo", "port": 9000}`)
+	_, err = runConfigCommand(t, file, "set", "core.console.width", "120")
+	assert.NoError(t, err)
+	bs, _ = os.ReadFile(file)
+	assert.Equal(t, `{
+  "name": "demo",
+  "port": 9000,
+  "core": {
+    "console": {
+      "width": 120
+    }
+  }
+}
+`, string(bs))
+}
+
+func Test_ConfigCommandValidate(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\nport: 80\n")
+	_, err := runConfigCommand(t, file, "validate")
+	if assert.Error(t, err) {
+		assert.Equal(t, file+":2:7: port: must be at least 1024", err.Error())
+	}
+
+	out, err := runConfigCommand(t, file, "validate", "testdata/server.yaml")
+	assert.Error(t, err)
+	assert.Equal(t, "", out)
+
+	valid := writeManaged(t, "valid.yaml", "name: other\n")
+	out, err = runConfigCommand(t, file, "validate", valid)
+	assert.NoError(t, err)
+	assert.Equal(t, valid+": valid\n", out)
+
+}
+
+func Test_ConfigCommandEdit(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\nport: 80\n")
+	edit := func(env mapEnv) (string, error) {
+		out := &bytes.Buffer{}
+		root := (&Command{Name: "demo"}).AddCommand(NewConfigCommand())
+		err := root.Execute(
+			context.Background(), &managedConfig{}, []string{"config", "edit"},
+			configurationOptionNoWatch(),
+			ConfigurationOptionConfigFile(file),
+			ConfigurationOptionEnvironment(env),
+			ConfigurationOptionOutput(out),
+		)
+		return out.String(), err
+	}
+
+	// The editor writes to the configured output, and the file is validated
+	// once it exits.
+	out, err := edit(mapEnv{"EDITOR": "echo editing"})
+	if assert.Error(t, err) {
+		assert.Equal(t, file+":2:7: port: must be at least 1024", err.Error())
+	}
+	assert.Equal(t, "editing "+file+"\n", out)
+
+	out, err = edit(mapEnv{"VISUAL": "sed -i s/80/8443/", "EDITOR": "false"})
+	assert.NoError(t, err)
+	assert.Equal(t, file+": valid\n", out)
+}
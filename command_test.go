@@ -0,0 +1,208 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type commandApp struct {
+	Name string         `yaml:"name" cmd:"--name" default:"demo"`
+	Core *Configuration `yaml:"core"`
+}
+type commandGlobal struct {
+	Verbose bool `cmd:"--verbose" desc:"Verbose output"`
+}
+type commandServe struct {
+	Port int    `cmd:"--port" default:"8080" validate:"min=1" desc:"Port to listen on"`
+	Mode string `cmd:"--mode" env:"${APPNAME}_MODE" validate:"oneof=dev prod" default:"dev" desc:"Server mode"`
+}
+
+type commandTree struct {
+	root    *Command
+	global  *commandGlobal
+	serve   *commandServe
+	ran     string
+	ranArgs []string
+}
+
+func newCommandTree() *commandTree {
+	tree := &commandTree{global: &commandGlobal{}, serve: &commandServe{}}
+	run := func(ctx context.Context, cmd *Command, args []string) error {
+		tree.ran = cmd.CommandPath()
+		tree.ranArgs = args
+		return nil
+	}
+	tree.root = &Command{Name: "demo", Description: "Demo application", PersistentConfig: tree.global}
+	tree.root.AddCommand(
+		&Command{Name: "serve", Aliases: []string{"s"}, Description: "Run the server", Config: tree.serve, Args: CommandArgsNone(), Run: run},
+		(&Command{Name: "config", Description: "Manage configuration"}).AddCommand(
+			&Command{Name: "get", Description: "Get a setting", Usage: "<key>", Args: CommandArgsExact(1), Run: run},
+		),
+	)
+	return tree
+}
+
+func Test_CommandExecute(t *testing.T) {
+	tests := map[string]struct {
+		args     []string
+		ran      string
+		ranArgs  []string
+		errStr   string
+		validate func(t *testing.T, tree *commandTree)
+	}{
+		"sub-command with flags": {
+			args: []string{"--verbose", "serve", "--port", "9000", "--mode=prod"},
+			ran:  "demo serve",
+			validate: func(t *testing.T, tree *commandTree) {
+				assert.True(t, tree.global.Verbose)
+				assert.Equal(t, 9000, tree.serve.Port)
+				assert.Equal(t, "prod", tree.serve.Mode)
+			},
+		},
+		"alias and defaults": {
+			args: []string{"s"},
+			ran:  "demo serve",
+			validate: func(t *testing.T, tree *commandTree) {
+				assert.Equal(t, 8080, tree.serve.Port)
+				assert.Equal(t, "dev", tree.serve.Mode)
+			},
+		},
+		"nested with persistent flag": {
+			args:    []string{"config", "get", "logger.level", "--verbose"},
+			ran:     "demo config get",
+			ranArgs: []string{"logger.level"},
+		},
+		"typo": {
+			args:   []string{"serv"},
+			errStr: `demo: unknown command "serv", did you mean serve?`,
+		},
+		"local flag of other command": {
+			args:   []string{"config", "get", "--port", "1"},
+			errStr: "--port: unknown flag",
+		},
+		"arguments": {
+			args:   []string{"config", "get"},
+			errStr: "demo config get: requires at least 1 argument(s), received 0",
+		},
+		"validation": {
+			args:   []string{"serve", "--mode", "test"},
+			errStr: "commands.demo.serve.mode: must be one of dev, prod",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			tree := newCommandTree()
+			err := tree.root.Execute(
+				context.Background(), &commandApp{}, test.args,
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(""),
+			)
+			if test.errStr != "" {
+				if assert.Error(tt, err) {
+					assert.Equal(tt, test.errStr, err.Error())
+				}
+				return
+			}
+			if assert.NoError(tt, err) {
+				assert.Equal(tt, test.ran, tree.ran)
+				assert.Equal(tt, test.ranArgs, tree.ranArgs)
+				if test.validate != nil {
+					test.validate(tt, tree)
+				}
+			}
+		})
+	}
+}
+
+func Test_CommandHelp(t *testing.T) {
+	t.Setenv("COLUMNS", "80")
+	out := &bytes.Buffer{}
+	tree := newCommandTree()
+	err := tree.root.Execute(
+		context.Background(), &commandApp{}, []string{"serve", "--help"},
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(""),
+		ConfigurationOptionAppName("demo"),
+		ConfigurationOptionOutput(out),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "", tree.ran)
+	assert.Equal(t, `Run the server
+
+Usage:
+  demo serve [flags]
+
+Flags:
+  --port int             Port to listen on (default: 8080)
+  --mode string          Server mode (one of: dev, prod; default: dev; env:
+                         DEMO_MODE)
+
+Inherited flags:
+  --verbose              Verbose output
+
+Options:
+  --name string          (default: demo)
+
+core.logger options:
+  --logger-level string  Minimum level of messages to log (one of: trace, debug,
+                         info, warn, error; default: info; env:
+                         DEMO_LOGGER_LEVEL)
+  --logger-colorized     Colorize log output (env: DEMO_LOGGER_COLORIZED)
+
+core.console options:
+  --console-width int    Minimum console width in columns
+  --console-height int   Minimum console height in rows
+`, out.String())
+
+	out.Reset()
+	err = newCommandTree().root.Execute(
+		context.Background(), &commandApp{}, nil,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(""),
+		ConfigurationOptionAppName("demo"),
+		ConfigurationOptionOutput(out),
+		ConfigurationOptionHelpTemplate(`{{range .Commands}}{{.Name}}: {{.Description}}{{"\n"}}{{end}}`),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "serve, s: Run the server\nconfig: Manage configuration\n", out.String())
+}
+
+func Test_CommandComplete(t *testing.T) {
+	tests := map[string]struct {
+		words    []string
+		expected string
+	}{
+		"commands": {
+			words:    []string{"s"},
+			expected: "serve\tRun the server\n",
+		},
+		"nested": {
+			words:    []string{"config", ""},
+			expected: "get\tGet a setting\n",
+		},
+		"command flags": {
+			words:    []string{"serve", "--m"},
+			expected: "--mode\tServer mode\n",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			err := newCommandTree().root.Execute(
+				context.Background(), &commandApp{}, append([]string{"--__complete"}, test.words...),
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(""),
+				ConfigurationOptionOutput(out),
+			)
+			assert.NoError(tt, err)
+			assert.Equal(tt, test.expected, out.String())
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	completeFlag   = "--__complete"
+	completionFlag = "--completion"
+)
+
+// CompletionFunc returns the candidate values for a flag or positional
+// argument. Candidates may carry a description after a tab character.
+type CompletionFunc func(prefix string) []string
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for {{.Name}}
+_{{.Func}}_complete() {
+    local IFS=$'\n'
+    COMPREPLY=($({{.Name}} {{.Flag}} "${COMP_WORDS[@]:1:$COMP_CWORD}" 2>/dev/null | cut -f1))
+}
+complete -o default -F _{{.Func}}_complete {{.Name}}
+`,
+	"zsh": `#compdef {{.Name}}
+_{{.Func}}_complete() {
+    local -a lines values descriptions
+    local line
+    lines=("${(@f)$({{.Name}} {{.Flag}} "${(@)words[2,$CURRENT]}" 2>/dev/null)}")
+    for line in $lines; do
+        [[ -z $line ]] && continue
+        values+=("${line%%$'\t'*}")
+        descriptions+=("${line/$'\t'/  -- }")
+    done
+    compadd -l -d descriptions -a values
+}
+compdef _{{.Func}}_complete {{.Name}}
+`,
+	"fish": `# fish completion for {{.Name}}
+function __{{.Func}}_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    {{.Name}} {{.Flag}} $tokens[2..-1] 2>/dev/null
+end
+complete -c {{.Name}} -f -a '(__{{.Func}}_complete)'
+`,
+}
+
+// ****** Completion **********************************************************
+
+// Completion writes the completion script for the named shell to w. The
+// script calls back into the binary through a hidden flag to obtain values.
+func (c *Configuration) Completion(w io.Writer, shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: completionFlag, err: fmt.Errorf("unsupported shell %q", shell)}
+	}
+	name := filepath.Base(c.Metadata.appName)
+	tmpl, err := template.New(shell).Parse(script)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, map[string]string{
+		"Name": name,
+		"Func": strings.ToLower(c.envPrefix()),
+		"Flag": completeFlag,
+	})
+}
+
+// complete writes the candidates for the last of words, which are the
+// command line arguments typed so far.
+func (c *Configuration) complete(w io.Writer, words []string) error {
+	current, previous := "", ""
+	if len(words) > 0 {
+		current = words[len(words)-1]
+	}
+	if len(words) > 1 {
+		previous = words[len(words)-2]
+	}
+
+	var candidates []string
+	if previous == setFlag && !strings.HasPrefix(current, "-") {
+		for _, s := range c.settings {
+			if c.inScope(s) && strings.HasPrefix(s.path+"=", current) {
+				candidates = append(candidates, s.path+"=\t"+s.desc)
+			}
+		}
+	} else if previous == configFormatFlag && !strings.HasPrefix(current, "-") {
+		for _, format := range []string{"yaml", "json"} {
+			if strings.HasPrefix(format, current) {
+				candidates = append(candidates, format)
+			}
+		}
+	} else if s := c.settingByFlag(previous); s != nil && s.value.Kind() != reflect.Bool && !strings.HasPrefix(current, "-") {
+		candidates = c.completeValue(s, "", current)
+	} else if flag, value, ok := strings.Cut(current, "="); ok && strings.HasPrefix(flag, "-") {
+		if s := c.settingByFlag(flag); s != nil {
+			candidates = c.completeValue(s, flag+"=", value)
+		}
+	} else if strings.HasPrefix(current, "-") {
+		for _, s := range c.settings {
+			if s.cmd != "" && c.inScope(s) && strings.HasPrefix(s.cmd, current) {
+				candidates = append(candidates, s.cmd+"\t"+s.desc)
+			}
+		}
+		if strings.HasPrefix("--help", current) {
+			candidates = append(candidates, "--help\tShow help")
+		}
+		if strings.HasPrefix(versionFlag, current) {
+			candidates = append(candidates, versionFlag+"\tShow version")
+		}
+		for _, flag := range [][2]string{
+			{setFlag, "Override a setting, as key=value"},
+			{configFlag, "Read the configuration from a file, or - for stdin"},
+			{configFormatFlag, "Format of the configuration, yaml or json"},
+		} {
+			if strings.HasPrefix(flag[0], current) {
+				candidates = append(candidates, flag[0]+"\t"+flag[1])
+			}
+		}
+	} else {
+		if c.command != nil && len(c.args) == 0 {
+			for _, sub := range c.command.commands {
+				if !sub.Hidden && strings.HasPrefix(sub.Name, current) {
+					candidates = append(candidates, sub.Name+"\t"+sub.Description)
+				}
+			}
+		}
+		if completeFunc, ok := c.Metadata.completions[""]; ok {
+			candidates = append(candidates, completeFunc(current)...)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if _, err := fmt.Fprintln(w, strings.TrimSuffix(candidate, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Configuration) completeValue(s *setting, prefix string, current string) []string {
+	var values []string
+	if completeFunc, ok := c.Metadata.completions[s.cmd]; ok {
+		values = completeFunc(current)
+	} else if enum := enumValues(s.validate); len(enum) > 0 {
+		for _, value := range enum {
+			if strings.HasPrefix(value, current) {
+				values = append(values, value)
+			}
+		}
+	}
+	if prefix == "" {
+		return values
+	}
+	candidates := make([]string, 0, len(values))
+	for _, value := range values {
+		candidates = append(candidates, prefix+value)
+	}
+	return candidates
+}
+
+// CompleteFiles returns a CompletionFunc listing the files and directories
+// matching the prefix. When extensions are given only files ending in one of
+// them are offered.
+func CompleteFiles(extensions ...string) CompletionFunc {
+	return func(prefix string) []string {
+		matches, _ := filepath.Glob(prefix + "*")
+		sort.Strings(matches)
+		var candidates []string
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				candidates = append(candidates, match+string(filepath.Separator))
+				continue
+			}
+			if len(extensions) == 0 {
+				candidates = append(candidates, match)
+				continue
+			}
+			for _, extension := range extensions {
+				if strings.HasSuffix(match, extension) {
+					candidates = append(candidates, match)
+					break
+				}
+			}
+		}
+		return candidates
+	}
+}
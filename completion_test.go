@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Complete(t *testing.T) {
+	tests := map[string]struct {
+		words    []string
+		expected string
+	}{
+		"flags": {
+			words:    []string{"--server-"},
+			expected: "--server-address\tAddress the server listens on\n--server-mode\tDeployment mode\n",
+		},
+		"enum value": {
+			words:    []string{"--server-mode", "p"},
+			expected: "prod\n",
+		},
+		"enum value with equals": {
+			words:    []string{"--logger-level=d"},
+			expected: "--logger-level=debug\n",
+		},
+		"dynamic value": {
+			words:    []string{"--server-address", "local"},
+			expected: "localhost:8080\nlocalhost:9090\n",
+		},
+		"set path": {
+			words:    []string{"--set", "mo"},
+			expected: "mode=\tDeployment mode\n",
+		},
+		"config format": {
+			words:    []string{"--config-format", ""},
+			expected: "yaml\njson\n",
+		},
+		"builtin flags": {
+			words:    []string{"--conf"},
+			expected: "--config\tRead the configuration from a file, or - for stdin\n--config-format\tFormat of the configuration, yaml or json\n",
+		},
+		"positional": {
+			words:    []string{"testdata/errors/type."},
+			expected: "testdata/errors/type.yaml\n",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			err := InitConfig(
+				context.Background(), &helpServer{},
+				configurationOptionNoWatch(),
+				ConfigurationOptionOutput(out),
+				ConfigurationOptionCompletion("--server-address", func(prefix string) []string {
+					return []string{"localhost:8080", "localhost:9090"}
+				}),
+				ConfigurationOptionCompletion("", CompleteFiles(".yaml")),
+				ConfigurationOptionArgs(append([]string{"--__complete"}, test.words...)),
+			)
+			assert.ErrorIs(tt, err, ErrCompletionRequested)
+			assert.Equal(tt, test.expected, out.String())
+		})
+	}
+}
+
+func Test_CompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			err := InitConfig(
+				context.Background(), &helpServer{},
+				configurationOptionNoWatch(),
+				ConfigurationOptionAppName("/usr/local/bin/demo-app"),
+				ConfigurationOptionOutput(out),
+				ConfigurationOptionArgs([]string{"--completion", shell}),
+			)
+			assert.ErrorIs(tt, err, ErrCompletionRequested)
+			assert.Contains(tt, out.String(), "demo_app_complete")
+			assert.Contains(tt, out.String(), "demo-app --__complete")
+		})
+	}
+
+	err := InitConfig(
+		context.Background(), &helpServer{},
+		configurationOptionNoWatch(),
+		ConfigurationOptionOutput(&bytes.Buffer{}),
+		ConfigurationOptionArgs([]string{"--completion=powershell"}),
+	)
+	if assert.Error(t, err) {
+		assert.Equal(t, `--completion: unsupported shell "powershell"`, err.Error())
+	}
+}
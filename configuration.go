@@ -6,19 +6,22 @@ package clif
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"os/user"
-	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 	"unsafe"
 
-	"github.com/fsnotify/fsnotify"
 	"gopkg.in/yaml.v3"
 )
 
@@ -31,25 +34,91 @@ var (
 type processFunc func(value reflect.Value, field reflect.StructField, level int, key string) error
 type ConfigurationOption func(c *Configuration) error
 type ConfigurationNotifyFunc func(setting string, value interface{})
+type ConfigurationErrorFunc func(err error)
+type ConfigurationReloadFunc func(old interface{}, new interface{}) error
+type ConfigurationRestartFunc func(settings []string)
 type configurationData struct {
-	lock        sync.Mutex
-	notifyFuncs map[string][]ConfigurationNotifyFunc
+	lock         sync.Mutex
+	notifyFuncs  map[string][]ConfigurationNotifyFunc
+	positions    map[string]position
+	settings     []*setting
+	flags        map[string]string
+	sets         map[string]string
+	args         []string
+	command      *Command
+	bindings     []*commandBinding
+	binding      *commandBinding
+	root         interface{}
+	fileHash     [sha256.Size]byte
+	fileContent  []byte
+	errorFunc    ConfigurationErrorFunc
+	reloadFuncs  []ConfigurationReloadFunc
+	reloadLock   sync.Mutex
+	restartFuncs []ConfigurationRestartFunc
+	restarts     []string
+	files        []*watchedFile
+	watchCtx     context.Context
+	envValues    map[string]envValue
+	filesChanged chan struct{}
+	auditLock    sync.Mutex
+	lastReload   *reloadResult
+	introspected string
 }
 type configurationMetadata struct {
-	appName    string
-	configFile string
-	homeDir    string
-	configDir  string
-	load       bool
-	watch      bool
-	wg         *sync.WaitGroup
-	watcher    *fsnotify.Watcher
+	appName       string
+	configFile    string
+	homeDir       string
+	configDir     string
+	dataDir       string
+	cacheDir      string
+	stateDir      string
+	runtimeDir    string
+	runtimeShared bool
+	load          bool
+	watch         bool
+	wg            *sync.WaitGroup
+	fileWatcher   FileWatcher
+	fileSystem    FileSystem
+	environment   Environment
+	clock         Clock
+	args          []string
+	help          bool
+	usage         string
+	helpTemplate  string
+	output        io.Writer
+	complete      []string
+	shell         string
+	completions   map[string]CompletionFunc
+	rootCommand   *Command
+	signals       []os.Signal
+	defaults      []byte
+	defaultsFile  string
+	buildInfo     *BuildInfo
+	version       string
+	logger        *Logger
+	strict        bool
+	deprecations  sync.Map
+	envNaming     NamingStrategy
+	flagNaming    NamingStrategy
+	ignoreKeyCase bool
+	configFormat  string
+	input         io.Reader
+	stdinConfig   []byte
+	debounce      time.Duration
+	envInterval   time.Duration
+	userName      string
+	audit         bool
+	introspect    string
+	auditFile     string
+	setup         bool
+	readKey       keyFunc
+	signal        chan os.Signal
 }
 type Configuration struct {
-	*configurationData
-	Metadata *configurationMetadata
-	Logger   *LoggerConfiguration  `json:"logger" yaml:"logger"`
-	Console  *ConsoleConfiguration `json:"console" yaml:"console"`
+	*configurationData `json:"-" yaml:"-"`
+	Metadata           *configurationMetadata `json:"-" yaml:"-"`
+	Logger             *LoggerConfiguration   `json:"logger" yaml:"logger"`
+	Console            *ConsoleConfiguration  `json:"console" yaml:"console"`
 }
 
 // ****** Construction ********************************************************
@@ -57,7 +126,7 @@ type Configuration struct {
 func InitConfig(ctx context.Context, configuration interface{}, options ...ConfigurationOption) error {
 	rv := reflect.ValueOf(configuration)
 	if rv.Kind() != reflect.Pointer || rv.IsNil() {
-		return &InvalidInitConfigError{Type: reflect.TypeOf(configuration)}
+		return &InvalidInitConfigError{Code: ErrArgumentCoreConfig, Type: reflect.TypeOf(configuration)}
 	}
 
 	var c *Configuration
@@ -83,19 +152,57 @@ func InitConfig(ctx context.Context, configuration interface{}, options ...Confi
 			if err := c.newConfiguration(ctx, options...); err != nil {
 				return err
 			}
+			c.root = configuration
+			if err := walkStructure(configuration, 0, "", c.collectSetting); err != nil {
+				return err
+			}
+			if c.Metadata.rootCommand != nil {
+				if err := c.bindCommand(c.Metadata.rootCommand); err != nil {
+					return err
+				}
+			}
+			if err := c.parseArgs(); err != nil {
+				return err
+			}
+			if c.Metadata.help {
+				if err := c.Usage(c.Metadata.output); err != nil {
+					return err
+				}
+				return ErrHelpRequested
+			}
+			if c.Metadata.version != "" {
+				if err := c.WriteVersion(c.Metadata.output, c.Metadata.version); err != nil {
+					return err
+				}
+				return ErrVersionRequested
+			}
+			if c.Metadata.complete != nil {
+				if err := c.complete(c.Metadata.output, c.Metadata.complete); err != nil {
+					return err
+				}
+				return ErrCompletionRequested
+			}
+			if c.Metadata.shell != "" {
+				if err := c.Completion(c.Metadata.output, c.Metadata.shell); err != nil {
+					return err
+				}
+				return ErrCompletionRequested
+			}
+			if c.Metadata.load && c.Metadata.setup {
+				if err := c.setupConfig(ctx); err != nil {
+					return err
+				}
+			}
 			if c.Metadata.load {
-				var cfg interface{}
-				cfg, err := c.unmarshalConfigFile(ctx, configuration)
-				if err != nil {
+				if err := c.unmarshalConfigFile(ctx, configuration); err != nil && !c.lenient() {
 					return err
 				}
-				fmt.Printf("%v\n", cfg)
 			}
 			found = true
 			break
 
 		} else if field.CanConvert(configurationType) {
-			return &InvalidInitConfigError{Type: configurationType}
+			return &InvalidInitConfigError{Code: ErrArgumentCoreConfig, Type: configurationType}
 		}
 	}
 
@@ -104,9 +211,41 @@ func InitConfig(ctx context.Context, configuration interface{}, options ...Confi
 	}
 
 	if c.Metadata.load {
-		if err := walkStructure(configuration, 0, "", processDefault, processEnvVar); err != nil {
+		c.settings = nil
+		fs := []processFunc{c.collectSetting, c.processDefault, c.processEnvVar, c.processFlag, c.processSet, c.processDeprecated}
+		if err := walkStructure(configuration, 0, "", fs...); err != nil && !c.lenient() {
 			return err
 		}
+		for _, b := range c.bindings {
+			if err := c.walkBinding(b, fs...); err != nil {
+				return err
+			}
+		}
+		if err := c.completeLoad(); err != nil {
+			if !c.lenient() {
+				return err
+			}
+		} else if err = c.afterLoad(ctx); err != nil {
+			return err
+		}
+		for _, s := range c.settings {
+			s.loaded = s.value.Interface()
+		}
+		c.envValues = c.envSnapshot()
+		if c.Metadata.watch && c.Metadata.configFile != "" && c.Metadata.configFile != stdinFile {
+			if err := c.watchConfigFile(); err != nil &&
+				!(c.Metadata.defaults != nil && errors.Is(err, os.ErrNotExist)) {
+				return err
+			}
+		}
+	}
+	if c.Metadata.introspect != "" {
+		if err := c.startIntrospection(ctx); err != nil {
+			return err
+		}
+	}
+	if c.Metadata.watch {
+		c.startWatch(ctx)
 	}
 	return nil
 }
@@ -122,42 +261,52 @@ func walkStructure(s interface{}, level int, key string, fs ...processFunc) erro
 	for i := 0; err == nil && i < rv.NumField(); i++ {
 		fv := rv.Field(i)
 		ft := rt.Field(i)
-		if fv.CanConvert(configurationTypePtr) && !ft.IsExported() {
-			fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
-		} else if !ft.IsExported() {
+		name, inline, ok := settingName(rt, ft)
+		if !ok {
 			continue
 		}
-		switch fv.Kind() {
-		case reflect.Struct:
-			fvp := reflect.New(fv.Type())
-			fvp.Elem().Set(fv)
-			err = walkStructure(fvp.Interface(), level+1, key+".", fs...)
-			fv.Set(fvp.Elem())
-		case reflect.Pointer:
+		if !ft.IsExported() {
+			fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		}
+		path := key
+		if !inline {
+			path = joinPath(key, name)
+		}
+		switch {
+		case isLeafType(ft.Type):
+			for _, f := range fs {
+				err = f(fv, ft, level, path)
+				if err != nil {
+					break
+				}
+			}
+		case fv.Kind() == reflect.Struct:
+			err = walkStructure(fv.Addr().Interface(), level+1, path, fs...)
+		case fv.Kind() == reflect.Pointer:
 			if fv.CanSet() {
 				if fv.IsNil() {
 					newInstance := reflect.New(ft.Type.Elem())
 					fv.Set(newInstance)
 				}
-				err = walkStructure(fv.Interface(), level+1, key+".", fs...)
-			}
-		default:
-			for _, f := range fs {
-				err = f(fv, ft, level, key)
-				if err != nil {
-					break
-				}
+				err = walkStructure(fv.Interface(), level+1, path, fs...)
 			}
 		}
 	}
 	return err
 }
 
-func processDefault(fv reflect.Value, ft reflect.StructField, level int, key string) error {
-	return nil
-}
-
-func processEnvVar(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+func (c *Configuration) processValidate(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+	if err := validateValue(ft.Tag.Get("validate"), fv); err != nil {
+		e := &InvalidInitConfigError{Code: ErrValidateCoreConfig, Path: key, err: err}
+		// A value overriding the file is not reported at the file's position.
+		if s := c.setting(key); s != nil && (s.source == sourceEnv || s.source == sourceFlag || s.source == sourceSet) {
+			return e
+		}
+		if pos, ok := c.positions[key]; ok {
+			e.File, e.Line, e.Column = pos.file, pos.line, pos.column
+		}
+		return e
+	}
 	return nil
 }
 
@@ -174,14 +323,26 @@ func (c *Configuration) setMetadataDefaults() error {
 	c.Metadata.appName = os.Args[0]
 	c.Metadata.configFile = "config.yaml"
 	c.Metadata.homeDir = currentUser.HomeDir
-	c.Metadata.configDir = filepath.Join(c.Metadata.homeDir, c.Metadata.configFile)
+	c.Metadata.userName = currentUser.Username
+	c.Metadata.helpTemplate = DefaultHelpTemplate
+	c.Metadata.output = os.Stdout
+	c.Metadata.input = os.Stdin
+	c.Metadata.debounce = fileDebounce
+	c.Metadata.envInterval = environmentInterval
+	c.Metadata.completions = make(map[string]CompletionFunc)
+	c.Metadata.fileSystem = &osFileSystem{}
+	c.Metadata.environment = osEnvironment{}
+	c.Metadata.clock = systemClock{}
+	c.Metadata.buildInfo = readBuildInfo()
 	return nil
 }
 
 func (c *Configuration) newConfiguration(ctx context.Context, options ...ConfigurationOption) error {
 	if c.configurationData == nil {
 		c.configurationData = &configurationData{
-			notifyFuncs: make(map[string][]ConfigurationNotifyFunc),
+			notifyFuncs:  make(map[string][]ConfigurationNotifyFunc),
+			positions:    make(map[string]position),
+			filesChanged: make(chan struct{}, 1),
 		}
 	}
 
@@ -190,63 +351,156 @@ func (c *Configuration) newConfiguration(ctx context.Context, options ...Configu
 			return err
 		}
 	}
-
-	if c.Metadata.watch {
-		var err error
-		c.Metadata.watcher, err = fsnotify.NewWatcher()
-		if err != nil {
-			return err
-		}
-		go c.watch(ctx)
-	}
+	c.resolveDirs()
 
 	return nil
 }
-func (c *Configuration) watch(ctx context.Context) {
+
+// startWatch starts the goroutine that reloads the configuration file when
+// it changes, on a reload signal, and polls the environment.
+func (c *Configuration) startWatch(ctx context.Context) {
+	if len(c.Metadata.signals) > 0 {
+		c.Metadata.signal = make(chan os.Signal, 1)
+		signal.Notify(c.Metadata.signal, c.Metadata.signals...)
+	}
 	if c.Metadata.wg != nil {
 		c.Metadata.wg.Add(1)
+	}
+	c.lock.Lock()
+	c.watchCtx = ctx
+	c.lock.Unlock()
+	go c.watch(ctx)
+}
+func (c *Configuration) watch(ctx context.Context) {
+	if c.Metadata.wg != nil {
 		defer c.Metadata.wg.Done()
 	}
-	timer := time.NewTicker(environmentInterval)
+	if c.Metadata.signal != nil {
+		defer signal.Stop(c.Metadata.signal)
+	}
+	var changes <-chan struct{}
+	var errs <-chan error
+	if w := c.Metadata.fileWatcher; w != nil {
+		changes, errs = w.Changes(), w.Errors()
+		defer func() { _ = w.Close() }()
+	}
+	// The environment is checked for changes every envInterval.
+	var timer Ticker
+	var envCheck <-chan time.Time
+	if c.Metadata.envInterval > 0 {
+		timer = c.Metadata.clock.NewTicker(c.Metadata.envInterval)
+		defer timer.Stop()
+		envCheck = timer.C()
+	}
+	// The debounce ticker runs while changes to watched files are settling.
+	var debounce Ticker
+	var settled <-chan time.Time
+	defer func() {
+		if debounce != nil {
+			debounce.Stop()
+		}
+		c.closeFiles()
+	}()
+
+	// The files watched by WatchFile come and go, so the select is built for
+	// the files being watched; their cases follow the fixed ones in pairs.
+	const (
+		selectChanges = iota
+		selectErrors
+		selectSignal
+		selectTimer
+		selectDone
+		selectFiles
+		selectSettled
+		selectWatched
+	)
 	for {
-		select {
-		case event, ok := <-c.Metadata.watcher.Events:
+		files := c.watchedFiles()
+		cases := []reflect.SelectCase{
+			selectChanges: recvCase(changes),
+			selectErrors:  recvCase(errs),
+			selectSignal:  recvCase(c.Metadata.signal),
+			selectTimer:   recvCase(envCheck),
+			selectDone:    recvCase(ctx.Done()),
+			selectFiles:   recvCase(c.filesChanged),
+			selectSettled: recvCase(settled),
+		}
+		for _, f := range files {
+			cases = append(cases, recvCase(f.watcher.Changes()), recvCase(f.watcher.Errors()))
+		}
+		chosen, value, ok := reflect.Select(cases)
+		switch chosen {
+		case selectChanges:
 			if !ok {
 				return
 			}
-			fmt.Println("event:", event)
-			if event.Has(fsnotify.Write) {
-				log.Println("modified file:", event.Name)
+			if err := c.reloadFile(ctx); err != nil {
+				c.notifyError(err)
 			}
-		case err, ok := <-c.Metadata.watcher.Errors:
+		case selectErrors:
 			if !ok {
 				return
 			}
-			fmt.Println("error:", err)
-		case <-timer.C:
+			c.notifyError(value.Interface().(error))
+		case selectSignal:
+			if err := c.Reload(ctx); err != nil {
+				c.notifyError(err)
+			}
+		case selectTimer:
 			timer.Stop()
-			c.checkForEnvChange()
-			timer.Reset(environmentInterval)
-		case <-ctx.Done():
-			_ = c.Metadata.watcher.Close()
+			if err := c.checkForEnvChange(ctx); err != nil {
+				c.notifyError(err)
+			}
+			timer.Reset(c.Metadata.envInterval)
+		case selectDone:
 			return
+		case selectFiles:
+		case selectSettled:
+			debounce.Stop()
+			settled = nil
+			for _, f := range files {
+				if f.pending {
+					f.pending = false
+					c.deliverFile(f)
+				}
+			}
+		default:
+			f := files[(chosen-selectWatched)/2]
+			switch {
+			case !ok:
+				c.unwatchFile(f)
+			case (chosen-selectWatched)%2 == 1:
+				c.fileError(f, value.Interface().(error))
+			default:
+				// Each change restarts the wait for the file to settle.
+				f.pending = true
+				if debounce == nil {
+					debounce = c.Metadata.clock.NewTicker(c.Metadata.debounce)
+				} else {
+					debounce.Reset(c.Metadata.debounce)
+				}
+				settled = debounce.C()
+			}
 		}
 	}
 }
-func (c *Configuration) checkForEnvChange() {
-	for setting, notifyFuncs := range c.configurationData.notifyFuncs {
-		value := os.Getenv(setting)
-		for _, notifyFunc := range notifyFuncs {
-			notifyFunc(setting, value)
-		}
+
+// recvCase is a select case receiving from ch, which may be nil.
+func recvCase[T any](ch <-chan T) reflect.SelectCase {
+	if ch == nil {
+		return reflect.SelectCase{Dir: reflect.SelectRecv}
 	}
+	return reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
 }
 func (c *Configuration) configType() string {
-	index := strings.LastIndex(c.Metadata.configFile, ".")
+	return c.formatOf(c.Metadata.configFile)
+}
+func fileFormat(file string) string {
+	index := strings.LastIndex(file, ".")
 	if index == -1 {
 		return ""
 	}
-	return strings.ToLower(c.Metadata.configFile[index+1:])
+	return strings.ToLower(file[index+1:])
 }
 
 // ****** Metadata functions **************************************************
@@ -257,6 +511,9 @@ func (m *configurationMetadata) AppName() string {
 func (m *configurationMetadata) HomeDir() string {
 	return m.homeDir
 }
+
+// ConfigDir returns the application's configuration directory,
+// $XDG_CONFIG_HOME/<app>, by default ~/.config/<app>.
 func (m *configurationMetadata) ConfigDir() string {
 	return m.configDir
 }
@@ -264,25 +521,103 @@ func (m *configurationMetadata) ConfigFile() string {
 	return m.configFile
 }
 
+// Args returns the positional arguments left on the command line once the
+// configuration flags have been removed.
+func (c *configurationData) Args() []string {
+	return c.args
+}
+
+// Command returns the command selected from the command line, if a command
+// tree is in use.
+func (c *configurationData) Command() *Command {
+	return c.command
+}
+
 // ****** Configuration unmarshal functions ***********************************
 
-func (c *Configuration) unmarshalConfigFile(ctx context.Context, config interface{}) (interface{}, error) {
-	if c.Metadata.configFile != "" {
-		bs, err := os.ReadFile(c.Metadata.configFile)
+func (c *Configuration) unmarshalConfigFile(ctx context.Context, config interface{}) error {
+	bs, err := c.readConfigFile()
+	if err != nil {
+		return err
+	}
+	positions, err := c.decodeConfig(c.Metadata.configFile, bs, config)
+	if err != nil {
+		return err
+	}
+	c.positions = positions
+	c.fileHash = sha256.Sum256(bs)
+	c.fileContent = bs
+	return nil
+}
+
+// readConfigFile reads the configuration file. When defaults are layered
+// beneath it, a missing file reads as an empty one.
+func (c *Configuration) readConfigFile() ([]byte, error) {
+	if c.Metadata.configFile == "" {
+		return nil, nil
+	}
+	if c.Metadata.configFile == stdinFile {
+		return c.readStdin()
+	}
+	bs, err := c.Metadata.fileSystem.ReadFile(c.Metadata.configFile)
+	if err != nil {
+		if c.Metadata.defaults != nil && errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
+	}
+	return bs, nil
+}
+
+// decodeConfig decodes the defaults, if any, and then file into config,
+// returning the positions of the settings found in either.
+func (c *Configuration) decodeConfig(file string, bs []byte, config interface{}) (map[string]position, error) {
+	positions := make(map[string]position)
+	if c.Metadata.defaults != nil {
+		doc, err := c.decodeDocument(c.Metadata.defaultsFile, c.Metadata.defaults, config)
 		if err != nil {
-			return nil, &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
+			return nil, err
 		}
-		switch c.configType() {
-		case "json":
-			err = json.Unmarshal(bs, config)
-		case "yaml", "yml":
-			err = yaml.Unmarshal(bs, config)
+		for path, pos := range doc.positions {
+			pos.defaults = true
+			positions[path] = pos
 		}
+	}
+	if file != "" {
+		doc, err := c.decodeDocument(file, bs, config)
 		if err != nil {
-			return nil, &InvalidInitConfigError{Code: ErrUnmarshalCoreConfig, err: err}
+			return nil, err
 		}
+		for path, pos := range doc.positions {
+			positions[path] = pos
+		}
+	}
+	return positions, nil
+}
+
+// decodeDocument parses, checks and decodes a configuration file into config,
+// moving renamed keys to their current paths first.
+func (c *Configuration) decodeDocument(file string, bs []byte, config interface{}) (*document, error) {
+	if file == stdinFile {
+		file = stdinName
+	}
+	doc, err := parseDocument(file, c.formatOf(file), bs)
+	if err != nil {
+		return nil, err
+	}
+	doc.env = c.Metadata.environment
+	doc.ignoreCase = c.Metadata.ignoreKeyCase
+	doc.rt = reflect.TypeOf(config)
+	if err = c.renameKeys(doc); err != nil {
+		return nil, err
 	}
-	return config, nil
+	if err = doc.check(reflect.TypeOf(config)); err != nil {
+		return nil, err
+	}
+	if err = doc.decode(config); err != nil {
+		return nil, &InvalidInitConfigError{Code: ErrUnmarshalCoreConfig, File: doc.file, err: err}
+	}
+	return doc, nil
 }
 func (c *Configuration) UnmarshalJSON(bs []byte) error {
 	data := map[string]interface{}{}
@@ -308,7 +643,7 @@ func (c *Configuration) unmarshalLoad(values map[string]interface{}) error {
 			if m, ok := value.(map[string]interface{}); ok {
 				c.Logger, err = newLoggerConfiguration(m)
 			} else {
-				return InvalidInitConfigError{
+				return &InvalidInitConfigError{
 					Code: ErrUnmarshalLoggerData,
 					err:  fmt.Errorf("%s != %s", key, "map[string]interface{}"),
 				}
@@ -317,8 +652,8 @@ func (c *Configuration) unmarshalLoad(values map[string]interface{}) error {
 			if m, ok := value.(map[string]interface{}); ok {
 				c.Console, err = newConsoleConfiguration(m)
 			} else {
-				return InvalidInitConfigError{
-					Code: ErrUnmarshalLoggerData,
+				return &InvalidInitConfigError{
+					Code: ErrUnmarshalConsoleData,
 					err:  fmt.Errorf("%s != %s", key, "map[string]interface{}"),
 				}
 			}
@@ -339,6 +674,67 @@ func (c *configurationData) AddNotifyOnChange(setting string, notifyFunc Configu
 	c.notifyFuncs[setting] = append(notifyFuncs, notifyFunc)
 }
 
+// AddOnReload adds a hook that is called with the live and the newly loaded
+// configuration when the configuration file is reloaded, before any value is
+// changed. Returning an error rejects the reload and keeps the live values.
+func (c *configurationData) AddOnReload(reloadFunc ConfigurationReloadFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reloadFuncs = append(c.reloadFuncs, reloadFunc)
+}
+
+// OnReload adds a reload hook typed to the application's configuration
+// struct, as passed to InitConfig. See AddOnReload.
+func OnReload[T any](c *Configuration, reloadFunc func(old *T, new *T) error) {
+	c.AddOnReload(func(old interface{}, new interface{}) error {
+		o, _ := old.(*T)
+		n, _ := new.(*T)
+		return reloadFunc(o, n)
+	})
+}
+
+// AddOnRestart adds a hook that is called, after a reload, with the settings
+// tagged restart that changed. Their new values are live, but only take full
+// effect once the application restarts. Without a hook a warning is logged.
+func (c *configurationData) AddOnRestart(restartFunc ConfigurationRestartFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.restartFuncs = append(c.restartFuncs, restartFunc)
+}
+
+// RestartRequired returns the settings tagged restart that have changed since
+// the configuration was first loaded.
+func (c *configurationData) RestartRequired() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string(nil), c.restarts...)
+}
+
+// vetoReload runs the reload hooks, stopping at the first that rejects the
+// newly loaded configuration.
+func (c *configurationData) vetoReload(fresh *Configuration) error {
+	c.lock.Lock()
+	reloadFuncs := append([]ConfigurationReloadFunc{}, c.reloadFuncs...)
+	c.lock.Unlock()
+
+	for _, reloadFunc := range reloadFuncs {
+		if err := reloadFunc(c.root, fresh.root); err != nil {
+			return &InvalidInitConfigError{Code: ErrReloadCoreConfig, File: fresh.Metadata.configFile, err: err}
+		}
+	}
+	return nil
+}
+
+func (c *configurationData) notify(setting string, value interface{}) {
+	c.lock.Lock()
+	notifyFuncs := append([]ConfigurationNotifyFunc{}, c.notifyFuncs[setting]...)
+	c.lock.Unlock()
+
+	for _, notifyFunc := range notifyFuncs {
+		notifyFunc(setting, value)
+	}
+}
+
 // ****** Options *************************************************************
 
 func ConfigurationOptionWaitGroup(wg *sync.WaitGroup) ConfigurationOption {
@@ -365,59 +761,122 @@ func ConfigurationOptionConfigFile(configFile string) ConfigurationOption {
 		return nil
 	}
 }
-func configurationOptionNoLoad() ConfigurationOption {
+
+// ConfigurationOptionArgs enables command line processing. Flags named by the
+// cmd tags are applied over the file and environment, and -h or --help writes
+// the usage text and causes InitConfig to return ErrHelpRequested. Likewise
+// --completion <shell> writes a bash, zsh or fish completion script and
+// returns ErrCompletionRequested, and --version, or --version=json, writes the
+// build information and returns ErrVersionRequested.
+func ConfigurationOptionArgs(args []string) ConfigurationOption {
 	return func(c *Configuration) error {
-		c.Metadata.load = false
+		c.Metadata.args = args
 		return nil
 	}
 }
-func configurationOptionNoWatch() ConfigurationOption {
+func ConfigurationOptionUsage(usage string) ConfigurationOption {
 	return func(c *Configuration) error {
-		c.Metadata.watch = false
+		c.Metadata.usage = usage
+		return nil
+	}
+}
+func ConfigurationOptionHelpTemplate(helpTemplate string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.helpTemplate = helpTemplate
+		return nil
+	}
+}
+func ConfigurationOptionOutput(output io.Writer) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.output = output
 		return nil
 	}
 }
 
-// ***** Error ****************************************************************
+// ConfigurationOptionCompletion registers a function providing the values
+// offered by shell completion for the named flag. An empty flag completes the
+// positional arguments.
+func ConfigurationOptionCompletion(flag string, complete CompletionFunc) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.completions[flag] = complete
+		return nil
+	}
+}
 
-const (
-	ErrMissingCoreConfig     = "CC01"
-	ErrAnonymousCoreConfig   = "CC02"
-	ErrUnmarshalCoreConfig   = "CC03"
-	ErrUnmarshalLoggerData   = "CC03LC01"
-	ErrUnmarshalConsoleData  = "CC03CC01"
-	ErrFileReadCoreConfig    = "CC04"
-	ErrNonExportedCoreConfig = "CC05"
-)
+// ConfigurationOptionErrorNotify registers a function to receive errors that
+// occur in the background, such as a configuration file that no longer loads
+// after it was changed. Without one, errors are written to the standard log.
+func ConfigurationOptionErrorNotify(errorFunc ConfigurationErrorFunc) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.errorFunc = errorFunc
+		return nil
+	}
+}
 
-type InvalidInitConfigError struct {
-	Code string
-	err  error
-	Type reflect.Type
-}
-
-func (e InvalidInitConfigError) Error() string {
-	switch e.Code {
-	case ErrMissingCoreConfig:
-		return "configuration error - InitConfig(core configuration not present)"
-	case ErrAnonymousCoreConfig:
-		return "configuration error - InitConfig(core configuration is anonymous)"
-	case ErrNonExportedCoreConfig:
-		return "configuration error - InitConfig(core configuration is unexported)"
-	case ErrUnmarshalCoreConfig, ErrUnmarshalLoggerData, ErrUnmarshalConsoleData,
-		ErrFileReadCoreConfig:
-		return fmt.Sprintf("configuration error - %v", e.err)
-	default:
-		if e.Type == nil {
-			return "configuration error - InitConfig(nil)"
+// ConfigurationOptionReloadSignal reloads the configuration, as Reload does,
+// when the process receives one of the signals, SIGHUP if none are given.
+// Errors are reported to the ConfigurationOptionErrorNotify function.
+func ConfigurationOptionReloadSignal(signals ...os.Signal) ConfigurationOption {
+	return func(c *Configuration) error {
+		if len(signals) == 0 {
+			signals = []os.Signal{syscall.SIGHUP}
 		}
+		c.Metadata.signals = signals
+		return nil
+	}
+}
+
+// ConfigurationOptionFileSystem reads, writes and watches the configuration
+// file through fileSystem instead of the operating system.
+func ConfigurationOptionFileSystem(fileSystem FileSystem) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.fileSystem = fileSystem
+		return nil
+	}
+}
 
-		if e.Type == configurationType {
-			return "configuration error - InitConfig(non-pointer of embedded " + e.Type.String() + ")"
-		} else if e.Type.Kind() != reflect.Pointer {
-			return "configuration error - InitConfig(non-pointer " + e.Type.String() + ")"
+// ConfigurationOptionDefaults layers the configuration file name in fsys,
+// typically an embed.FS built into the application, beneath the configuration
+// file. Settings the configuration file leaves out keep their value from the
+// defaults, which are reported with the default source, and the configuration
+// file need not exist.
+func ConfigurationOptionDefaults(fsys fs.FS, name string) ConfigurationOption {
+	return func(c *Configuration) error {
+		bs, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
 		}
+		c.Metadata.defaults, c.Metadata.defaultsFile = bs, name
+		return nil
+	}
+}
 
-		return "configuration error - InitConfig(nil " + e.Type.String() + ")"
+// ConfigurationOptionEnvironment looks up environment variables, for env tags
+// and file interpolation, in env instead of the process environment.
+func ConfigurationOptionEnvironment(env Environment) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.environment = env
+		return nil
+	}
+}
+
+// ConfigurationOptionClock drives the periodic checks of the watcher from
+// clock instead of the system clock.
+func ConfigurationOptionClock(clock Clock) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.clock = clock
+		return nil
+	}
+}
+func configurationOptionNoLoad() ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.load = false
+		return nil
+	}
+}
+func configurationOptionNoWatch() ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.watch = false
+		return nil
 	}
 }
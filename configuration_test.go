@@ -160,15 +160,18 @@ func Test_Walker(t *testing.T) {
 	tests := map[string]struct {
 		config   interface{}
 		filename string
+		number   interface{}
 	}{
 		"yaml": {
 			config:   &WalkerA{WalkerBPtr: &WalkerB{}},
 			filename: "testdata/config.yaml",
+			number:   1,
+		},
+		"json": {
+			config:   &WalkerA{WalkerBPtr: &WalkerB{}},
+			filename: "testdata/config.json",
+			number:   float64(1),
 		},
-		//"json": {
-		//	config:   &WalkerA{WalkerBPtr: &WalkerB{}},
-		//	filename: "testdata/config.json",
-		//},
 	}
 	for name, test := range tests {
 		t.Run(name, func(tt *testing.T) {
@@ -184,7 +187,7 @@ func Test_Walker(t *testing.T) {
 				t.Fatalf("%v", err)
 			}
 			assert.Equal(tt, "walkerA.external", actual.External)
-			assert.Equal(tt, map[string]interface{}{"int": 1, "bool": true, "string": "string"}, actual.Mappy)
+			assert.Equal(tt, map[string]interface{}{"int": test.number, "bool": true, "string": "string"}, actual.Mappy)
 			assert.Equal(tt, []string{"one", "two", "three"}, actual.Things)
 			assert.Equal(tt, "blah", actual.Object)
 			assert.Equal(tt, -1, actual.Number)
@@ -202,3 +205,120 @@ func Test_Walker(t *testing.T) {
 		})
 	}
 }
+
+type errorConfig struct {
+	Name string         `yaml:"name" json:"name" validate:"required"`
+	Port int            `yaml:"port" json:"port" validate:"min=1024,max=65535"`
+	Core *Configuration `yaml:"core" json:"core"`
+}
+
+func Test_ConfigErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := map[string]struct {
+		filename string
+		errStr   string
+	}{
+		"type mismatch": {
+			filename: "testdata/errors/type.yaml",
+			errStr:   "testdata/errors/type.yaml:5:12: core.console.width: expected int",
+		},
+		"json type mismatch": {
+			filename: "testdata/errors/type.json",
+			errStr:   "testdata/errors/type.json:3:11: port: expected int",
+		},
+		"unknown key": {
+			filename: "testdata/errors/unknown.yaml",
+			errStr:   "testdata/errors/unknown.yaml:3:1: colour: unknown key",
+		},
+		"validation": {
+			filename: "testdata/errors/validate.yaml",
+			errStr:   "testdata/errors/validate.yaml:2:7: port: must be at least 1024",
+		},
+		"interpolation": {
+			filename: "testdata/errors/interpolate.yaml",
+			errStr:   "testdata/errors/interpolate.yaml:1:7: name: undefined variable CLIF_TEST_UNDEFINED_NAME",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			err := InitConfig(
+				ctx, &errorConfig{},
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(test.filename),
+			)
+			if assert.Error(tt, err) {
+				assert.Equal(tt, test.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func Test_ConfigInterpolation(t *testing.T) {
+	t.Setenv("CLIF_TEST_PORT", "8443")
+	config := &errorConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile("testdata/errors/interpolate_ok.yaml"),
+	)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "fallback-${literal}", config.Name)
+		assert.Equal(t, 8443, config.Port)
+	}
+}
+
+type jsonConfig struct {
+	MyField string `json:"my_field"`
+	Nested  struct {
+		Count int `json:"count" validate:"min=1"`
+	} `json:"nested_block"`
+	Core *Configuration `json:"core"`
+}
+
+func Test_ConfigJSONTags(t *testing.T) {
+	// A JSON file is matched against json tags, as encoding/json would.
+	file := writeManaged(t, "c.json", `{"my_field": "value", "nested_block": {"count": 2}}`)
+	config := &jsonConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "value", config.MyField)
+		assert.Equal(t, 2, config.Nested.Count)
+	}
+
+	file = writeManaged(t, "c.json", "{\n  \"my_field\": \"value\",\n  \"nested_block\": {\"count\": 0},\n  \"myfield\": 1\n}")
+	err = InitConfig(context.Background(), &jsonConfig{}, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if assert.Error(t, err) {
+		assert.Equal(t, file+":4:3: myfield: unknown key", err.Error())
+	}
+}
+
+func Test_ConfigPrecedence(t *testing.T) {
+	t.Setenv("DEMO_ADDRESS", "0.0.0.0:9000")
+	t.Setenv("DEMO_LOGGER_LEVEL", "warn")
+	config := &helpServer{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionAppName("demo"),
+		ConfigurationOptionConfigFile("testdata/server.yaml"),
+		ConfigurationOptionArgs([]string{"--server-mode=prod", "--verbose", "--logger-level", "error", "input.txt"}),
+	)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0.0.0.0:9000", config.Address)
+		assert.Equal(t, "prod", config.Mode)
+		assert.Equal(t, true, config.Verbose)
+		assert.Equal(t, "from-file", config.Token)
+		assert.Equal(t, "error", config.Core.Logger.Level())
+		assert.Equal(t, []string{"input.txt"}, config.Core.Args())
+	}
+
+	err = InitConfig(
+		context.Background(), &helpServer{},
+		configurationOptionNoWatch(),
+		configurationOptionNoLoad(),
+		ConfigurationOptionArgs([]string{"--server-port", "80"}),
+	)
+	if assert.Error(t, err) {
+		assert.Equal(t, "--server-port: unknown flag", err.Error())
+	}
+}
@@ -23,21 +23,13 @@ var (
 	synchronize      sync.Mutex
 )
 
-var (
-	ErrConsoleNoTerminal       = fmt.Errorf("console error - no terminal available")
-	ErrConsoleInvalidRawMode   = fmt.Errorf("console error - unable to enter raw mode")
-	ErrConsoleSizeUnavailable  = fmt.Errorf("console error - unable to obtain dimensions")
-	ErrConsoleUnmarshalType    = fmt.Errorf("console error - invalid type")
-	ErrConsoleSizeNonCompliant = fmt.Errorf("console warn - requested size not met")
-)
-
 type ConsoleOption func(c *Console) error
 type ConsoleResizeFunc func(width, height int)
 type ConsoleStopFunc func()
 type ConsoleWaitGroup func(wg *sync.WaitGroup)
 type consoleConfigurationData struct {
-	width  int `cmd:"--console-width"`
-	height int `cmd:"--console-height"`
+	width  int `cmd:"--console-width" desc:"Minimum console width in columns"`
+	height int `cmd:"--console-height" desc:"Minimum console height in rows"`
 }
 type ConsoleConfiguration struct {
 	*consoleConfigurationData
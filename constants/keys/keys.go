@@ -118,7 +118,6 @@ func MakeKey(bs []byte) (*Key, bool) {
 		n := utf8.EncodeRune(bs2, 'ǎ')
 		fmt.Printf("%d", n)
 		r, _ := utf8.DecodeRune(bs[1:])
-		fmt.Sprintf("%s", string(bs))
 		return newKey(ModifierNone, r), true
 	} else if size == 2 {
 		r, _ := utf8.DecodeRune(bs)
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/defaults.yaml
+var embeddedDefaults embed.FS
+
+func Test_Defaults(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "port: 9100\n")
+	config := &managedConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionDefaults(embeddedDefaults, "testdata/defaults.yaml"),
+		ConfigurationOptionConfigFile(file),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "demo", config.Name)
+	assert.Equal(t, 9100, config.Port)
+	assert.Equal(t, "changeme", config.Password)
+	assert.Equal(t, sourceDefault, config.Core.setting("name").source)
+	assert.Equal(t, sourceFile, config.Core.setting("port").source)
+
+	// Only what the user file sets is saved back to it.
+	assert.NoError(t, config.Core.Save())
+	bs, err := config.Core.Metadata.fileSystem.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "port: 9100\n", string(bs))
+}
+
+func Test_DefaultsWithoutFile(t *testing.T) {
+	defaults := fstest.MapFS{"defaults.yaml": {Data: []byte("name: demo\nport: 1\n")}}
+	config := &managedConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionDefaults(defaults, "defaults.yaml"),
+		ConfigurationOptionConfigFile(filepath.Join(t.TempDir(), "missing.yaml")),
+	)
+	if assert.Error(t, err) {
+		assert.Equal(t, "defaults.yaml:2:7: port: must be at least 1024", err.Error())
+	}
+
+	err = InitConfig(
+		context.Background(), &managedConfig{},
+		configurationOptionNoWatch(),
+		ConfigurationOptionDefaults(defaults, "absent.yaml"),
+	)
+	if assert.Error(t, err) {
+		assert.Equal(t, "configuration error - open absent.yaml: file does not exist", err.Error())
+	}
+}
+
+func Test_ReadOnlyFileSystem(t *testing.T) {
+	fsys := fstest.MapFS{"etc/app.yaml": {Data: []byte("name: mapped\n")}}
+	config := &managedConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionFileSystem(ReadOnlyFileSystem(fsys)),
+		ConfigurationOptionConfigFile("etc/app.yaml"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "mapped", config.Name)
+	assert.Equal(t, 8080, config.Port)
+	assert.ErrorIs(t, config.Core.Persist("port", 9000), fs.ErrPermission)
+}
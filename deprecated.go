@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ****** Deprecation *********************************************************
+
+// parseAliases splits an alias tag into the old names of a setting. Names
+// starting with -- are flags, names starting with $ are environment
+// variables, and anything else is a dotted key in the configuration file.
+func (c *Configuration) parseAliases(s *setting, tag string) {
+	for _, alias := range strings.Fields(tag) {
+		switch {
+		case strings.HasPrefix(alias, "--"):
+			s.flagAliases = append(s.flagAliases, alias)
+		case strings.HasPrefix(alias, "$"):
+			s.envAliases = append(s.envAliases, c.expandEnvName(alias[1:]))
+		default:
+			s.aliases = append(s.aliases, alias)
+		}
+	}
+}
+
+// fileAliases maps the old keys of renamed settings to their current paths.
+func (c *Configuration) fileAliases() map[string]string {
+	aliases := make(map[string]string)
+	for _, s := range c.settings {
+		if s.command == nil {
+			for _, alias := range s.aliases {
+				aliases[alias] = s.path
+			}
+		}
+	}
+	return aliases
+}
+
+// renameKeys moves renamed keys in the document to their current paths,
+// reporting each old key found.
+func (c *Configuration) renameKeys(doc *document) error {
+	aliases := c.fileAliases()
+	renamed, err := doc.rename(aliases)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(renamed))
+	for key := range renamed {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return renamed[keys[i]].Line < renamed[keys[j]].Line })
+	for _, key := range keys {
+		e := doc.errorAt(renamed[key], ErrDeprecatedCoreConfig, key, "deprecated, use %s", aliases[key])
+		if err = c.deprecate(e.(*InvalidInitConfigError)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processDeprecated reports a setting with a deprecated tag that was given a
+// value by the file, environment or command line.
+func (c *Configuration) processDeprecated(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+	s := c.setting(key)
+	if s == nil || !s.deprecated {
+		return nil
+	}
+	e := &InvalidInitConfigError{Code: ErrDeprecatedCoreConfig, Path: key, err: fmt.Errorf("deprecated")}
+	if msg := ft.Tag.Get("deprecated"); msg != "" {
+		e.err = fmt.Errorf("deprecated, %s", msg)
+	}
+	switch s.source {
+	case sourceFile:
+		if pos, ok := c.positions[key]; ok {
+			e.File, e.Line, e.Column = pos.file, pos.line, pos.column
+		}
+	case sourceEnv:
+		e.Path = "$" + s.env
+	case sourceFlag:
+		e.Path = s.cmd
+	case sourceSet:
+		e.Path = setFlag + " " + key
+	default:
+		return nil
+	}
+	return c.deprecate(e)
+}
+
+// deprecate reports the use of a deprecated name. It is logged as a warning,
+// once for each name, or returned as an error when deprecations are strict.
+func (c *Configuration) deprecate(e *InvalidInitConfigError) error {
+	if c.Metadata.strict {
+		return e
+	}
+	if _, warned := c.Metadata.deprecations.LoadOrStore(e.Path, true); !warned {
+		c.warn(e.Error())
+	}
+	return nil
+}
+
+// replacement names what to use instead of a deprecated alias of s.
+func (s *setting) replacement(prefix string, name string) string {
+	if name != "" {
+		return prefix + name
+	}
+	return s.path
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionLogger sends warnings, such as the use of deprecated
+// settings, to logger instead of the standard log.
+func ConfigurationOptionLogger(logger *Logger) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.logger = logger
+		return nil
+	}
+}
+
+// ConfigurationOptionStrict makes the use of a deprecated setting, or of the
+// old name of a renamed one, an error rather than a warning.
+func ConfigurationOptionStrict() ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.strict = true
+		return nil
+	}
+}
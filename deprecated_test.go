@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type deprecatedServer struct {
+	Port int `yaml:"port" alias:"listen_port server.listen --listen"`
+}
+
+type deprecatedConfig struct {
+	Level   string           `yaml:"level" env:"APP_LEVEL" cmd:"--level" alias:"log_level --log-level $APP_LOG_LEVEL"`
+	Verbose bool             `yaml:"verbose" cmd:"--verbose" deprecated:"use level"`
+	Server  deprecatedServer `yaml:"server"`
+	Core    *Configuration   `yaml:"core"`
+}
+
+func initDeprecated(t *testing.T, content string, env mapEnv, args []string, options ...ConfigurationOption) (*deprecatedConfig, *Logger, string, error) {
+	file := writeManaged(t, "config.yaml", content)
+	logger, _ := NewLogger()
+	config := &deprecatedConfig{}
+	err := InitConfig(context.Background(), config, append([]ConfigurationOption{
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(env),
+		ConfigurationOptionArgs(args),
+		ConfigurationOptionLogger(logger),
+	}, options...)...)
+	return config, logger, file, err
+}
+
+func warnings(logger *Logger) []string {
+	var messages []string
+	for _, message := range logger.history.messages {
+		start := strings.Index(message, "m") + 1
+		end := strings.LastIndex(message, "\x1b[0m")
+		messages = append(messages, message[start:end])
+	}
+	return messages
+}
+
+func Test_DeprecatedFile(t *testing.T) {
+	content := "# old names\nlog_level: debug # kept\nverbose: true\nserver:\n  listen: 9000\n"
+	config, logger, file, err := initDeprecated(t, content, mapEnv{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", config.Level)
+	assert.True(t, config.Verbose)
+	assert.Equal(t, 9000, config.Server.Port)
+	assert.Equal(t, []string{
+		file + ":2:1: log_level: deprecated, use level",
+		file + ":5:3: server.listen: deprecated, use server.port",
+		file + ":3:10: verbose: deprecated, use level",
+	}, warnings(logger))
+
+	// Reloading warns no more, and saving migrates the renamed keys.
+	assert.NoError(t, config.Core.Reload(context.Background()))
+	assert.Len(t, warnings(logger), 3)
+	assert.NoError(t, config.Core.Persist("server.port", 9001))
+	bs, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "# old names\nlevel: debug # kept\nverbose: true\nserver:\n  port: 9001\n", string(bs))
+
+	// The current name wins over an old one.
+	config, _, _, err = initDeprecated(t, "level: warn\nlog_level: debug\nlisten_port: 1\n", mapEnv{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", config.Level)
+	assert.Equal(t, 1, config.Server.Port)
+}
+
+func Test_DeprecatedEnvAndFlags(t *testing.T) {
+	config, logger, _, err := initDeprecated(t, "", mapEnv{"APP_LOG_LEVEL": "info"}, []string{"--listen", "8000", "--verbose"})
+	assert.NoError(t, err)
+	assert.Equal(t, "info", config.Level)
+	assert.Equal(t, 8000, config.Server.Port)
+	assert.Equal(t, []string{
+		"--listen: deprecated, use server.port",
+		"$APP_LOG_LEVEL: deprecated, use $APP_LEVEL",
+		"--verbose: deprecated, use level",
+	}, warnings(logger))
+
+	config, _, _, err = initDeprecated(t, "", mapEnv{"APP_LOG_LEVEL": "info", "APP_LEVEL": "error"}, []string{"--log-level=trace"})
+	assert.NoError(t, err)
+	assert.Equal(t, "trace", config.Level)
+}
+
+func Test_DeprecatedStrict(t *testing.T) {
+	_, _, file, err := initDeprecated(t, "log_level: debug\n", mapEnv{}, nil, ConfigurationOptionStrict())
+	if assert.Error(t, err) {
+		assert.Equal(t, file+":1:1: log_level: deprecated, use level", err.Error())
+	}
+	_, _, _, err = initDeprecated(t, "", mapEnv{}, []string{"--log-level", "debug"}, ConfigurationOptionStrict())
+	if assert.Error(t, err) {
+		assert.Equal(t, "--log-level: deprecated, use --level", err.Error())
+	}
+	_, logger, _, err := initDeprecated(t, "level: debug\n", mapEnv{}, nil, ConfigurationOptionStrict())
+	assert.NoError(t, err)
+	assert.Empty(t, warnings(logger))
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+type ChangeKind string
+
+// Change is a single difference between two configurations, identified by the
+// dotted path of the setting. Old is nil for added settings and New is nil
+// for removed ones.
+type Change struct {
+	Path   string
+	Kind   ChangeKind
+	Old    interface{}
+	New    interface{}
+	Secret bool
+}
+
+// Diff is the ordered list of changes between two configurations.
+type Diff []Change
+
+type diffEntry struct {
+	value  interface{}
+	secret bool
+}
+
+// ****** Diff ****************************************************************
+
+// DiffFiles compares two configuration files using the configuration's type.
+// A setting is added or removed when only one of the files sets it.
+func (c *Configuration) DiffFiles(oldFile string, newFile string) (Diff, error) {
+	oldSettings, err := c.fileSettings(oldFile)
+	if err != nil {
+		return nil, err
+	}
+	newSettings, err := c.fileSettings(newFile)
+	if err != nil {
+		return nil, err
+	}
+	return diffSettings(oldSettings, newSettings, true), nil
+}
+
+// DiffEffective compares a configuration file with the effective
+// configuration, that is the file, environment, command line and runtime
+// changes combined.
+func (c *Configuration) DiffEffective(file string) (Diff, error) {
+	fileSettings, err := c.fileSettings(file)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return diffSettings(fileSettings, c.settings, false), nil
+}
+
+func (c *Configuration) fileSettings(file string) ([]*setting, error) {
+	bs, err := c.Metadata.fileSystem.ReadFile(file)
+	if err != nil {
+		return nil, &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
+	}
+	fresh, err := c.loadInstance(file, bs, false)
+	if err != nil {
+		return nil, err
+	}
+	return fresh.settings, nil
+}
+
+// diffSettings compares two sets of settings. With explicit set, only the
+// settings read from a file take part, so a setting the old file does not
+// mention is reported as added; otherwise every setting's value is compared.
+func diffSettings(oldSettings []*setting, newSettings []*setting, explicit bool) Diff {
+	var paths []string
+	oldEntries := diffEntries(oldSettings, explicit, &paths)
+	newEntries := diffEntries(newSettings, explicit, &paths)
+
+	var diff Diff
+	for _, path := range paths {
+		o, inOld := oldEntries[path]
+		n, inNew := newEntries[path]
+		switch {
+		case inOld && inNew && !reflect.DeepEqual(o.value, n.value):
+			diff = append(diff, Change{Path: path, Kind: ChangeChanged, Old: o.value, New: n.value, Secret: o.secret || n.secret})
+		case inOld && !inNew:
+			diff = append(diff, Change{Path: path, Kind: ChangeRemoved, Old: o.value, Secret: o.secret})
+		case !inOld && inNew:
+			diff = append(diff, Change{Path: path, Kind: ChangeAdded, New: n.value, Secret: n.secret})
+		}
+	}
+	return diff
+}
+
+func diffEntries(settings []*setting, explicit bool, paths *[]string) map[string]diffEntry {
+	entries := make(map[string]diffEntry)
+	for _, s := range settings {
+		if s.command != nil || (explicit && s.source != sourceFile) {
+			continue
+		}
+		if _, ok := entries[s.path]; !ok && !contains(*paths, s.path) {
+			*paths = append(*paths, s.path)
+		}
+		entries[s.path] = diffEntry{value: s.value.Interface(), secret: s.secret}
+	}
+	return entries
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ****** Rendering ***********************************************************
+
+func (ch Change) String() string {
+	switch ch.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", ch.Path, ch.display(ch.New))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", ch.Path, ch.display(ch.Old))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", ch.Path, ch.display(ch.Old), ch.display(ch.New))
+	}
+}
+
+// MarshalJSON renders the change with secret values redacted.
+func (ch Change) MarshalJSON() ([]byte, error) {
+	type change struct {
+		Path string      `json:"path"`
+		Kind ChangeKind  `json:"kind"`
+		Old  interface{} `json:"old,omitempty"`
+		New  interface{} `json:"new,omitempty"`
+	}
+	out := change{Path: ch.Path, Kind: ch.Kind, Old: ch.Old, New: ch.New}
+	if ch.Secret {
+		out.Old, out.New = ch.redact(ch.Old), ch.redact(ch.New)
+	}
+	return json.Marshal(out)
+}
+
+func (ch Change) display(value interface{}) string {
+	if ch.Secret {
+		if v := ch.redact(value); v != nil {
+			return redacted
+		}
+	}
+	return formatValue(reflect.ValueOf(value))
+}
+
+func (ch Change) redact(value interface{}) interface{} {
+	if value == nil || reflect.ValueOf(value).IsZero() {
+		return value
+	}
+	return redacted
+}
+
+func (d Diff) String() string {
+	lines := make([]string, 0, len(d))
+	for _, change := range d {
+		lines = append(lines, change.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiffFiles(t *testing.T) {
+	oldFile := writeManaged(t, "old.yaml", "name: demo\nport: 9000\npassword: hunter2\n")
+	newFile := writeManaged(t, "new.yaml", "name: demo\npassword: swordfish\ncore:\n  logger:\n    level: debug\n")
+	config := &managedConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(oldFile))
+	assert.NoError(t, err)
+
+	diff, err := config.Core.DiffFiles(oldFile, newFile)
+	assert.NoError(t, err)
+	assert.Equal(t, Diff{
+		{Path: "port", Kind: ChangeRemoved, Old: 9000},
+		{Path: "password", Kind: ChangeChanged, Old: "hunter2", New: "swordfish", Secret: true},
+		{Path: "core.logger.level", Kind: ChangeAdded, New: "debug"},
+	}, diff)
+	assert.Equal(t, "- port: 9000\n~ password: ****** -> ******\n+ core.logger.level: debug", diff.String())
+
+	bs, err := json.Marshal(diff)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"path":"port","kind":"removed","old":9000},`+
+		`{"path":"password","kind":"changed","old":"******","new":"******"},`+
+		`{"path":"core.logger.level","kind":"added","new":"debug"}]`, string(bs))
+
+	_, err = config.Core.DiffFiles(oldFile, newFile+".missing")
+	assert.Error(t, err)
+}
+
+func Test_DiffEffective(t *testing.T) {
+	file := writeManaged(t, "config.yaml", managedYAML)
+	config := &managedConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	assert.NoError(t, err)
+
+	diff, err := config.Core.DiffEffective(file)
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+
+	assert.NoError(t, config.Core.Set("port", "9100"))
+	diff, err = config.Core.DiffEffective(file)
+	assert.NoError(t, err)
+	assert.Equal(t, Diff{{Path: "port", Kind: ChangeChanged, Old: 9000, New: 9100}}, diff)
+
+	out, err := runConfigCommand(t, file, "diff", file)
+	assert.NoError(t, err)
+	assert.Equal(t, "no differences\n", out)
+
+	other := writeManaged(t, "other.yaml", "name: other\nport: 9000\npassword: hunter2\n")
+	out, err = runConfigCommand(t, file, "diff", file, other)
+	assert.NoError(t, err)
+	assert.Equal(t, "~ name: demo -> other\n", out)
+}
+
+func Test_DiffReload(t *testing.T) {
+	file := writeManaged(t, "config.yaml", managedYAML)
+	config := &managedConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	assert.NoError(t, err)
+
+	var notified []Change
+	for _, path := range []string{"name", "port", "password"} {
+		config.Core.AddNotifyOnChange(path, func(setting string, value interface{}) {
+			notified = append(notified, Change{Path: setting, New: value})
+		})
+	}
+
+	assert.NoError(t, os.WriteFile(file, []byte("name: demo\nport: 9001\npassword: swordfish\n"), 0o600))
+	// Before the reload the effective configuration is the old one, so the
+	// reload must notify exactly the changes this diff reports, with the
+	// file's values.
+	expected, err := config.Core.DiffEffective(file)
+	assert.NoError(t, err)
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+
+	assert.Len(t, notified, len(expected))
+	for i, change := range expected {
+		assert.Equal(t, change.Path, notified[i].Path)
+		assert.Equal(t, change.Old, notified[i].New)
+	}
+	assert.Equal(t, 9001, config.Port)
+	assert.Equal(t, "swordfish", config.Password)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// xdgDir describes one of the XDG base directories: the variable naming it,
+// and where it is when the variable is unset.
+type xdgDir struct {
+	env      string
+	home     string
+	fallback func() (string, error)
+}
+
+var (
+	xdgConfig = xdgDir{env: "XDG_CONFIG_HOME", home: ".config", fallback: os.UserConfigDir}
+	xdgData   = xdgDir{env: "XDG_DATA_HOME", home: filepath.Join(".local", "share"), fallback: os.UserConfigDir}
+	xdgCache  = xdgDir{env: "XDG_CACHE_HOME", home: ".cache", fallback: os.UserCacheDir}
+	xdgState  = xdgDir{env: "XDG_STATE_HOME", home: filepath.Join(".local", "state"), fallback: os.UserCacheDir}
+)
+
+// ****** Directories *********************************************************
+
+// resolveDirs fills in the application directories not set by an option,
+// following the XDG base directory specification. Windows, which has no such
+// convention, uses its roaming and local application data directories.
+func (c *Configuration) resolveDirs() {
+	name := filepath.Base(c.Metadata.appName)
+	resolve := func(dir *string, xdg xdgDir) {
+		if *dir == "" {
+			*dir = filepath.Join(c.xdgBase(xdg), name)
+		}
+	}
+	resolve(&c.Metadata.configDir, xdgConfig)
+	resolve(&c.Metadata.dataDir, xdgData)
+	resolve(&c.Metadata.cacheDir, xdgCache)
+	resolve(&c.Metadata.stateDir, xdgState)
+	if c.Metadata.runtimeDir == "" {
+		if base, ok := c.Metadata.environment.LookupEnv("XDG_RUNTIME_DIR"); ok && filepath.IsAbs(base) {
+			c.Metadata.runtimeDir = filepath.Join(base, name)
+		} else {
+			c.Metadata.runtimeDir = filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d", name, os.Getuid()))
+			c.Metadata.runtimeShared = true
+		}
+	}
+}
+
+// xdgBase returns the base directory named by the XDG variable, ignoring a
+// relative path as the specification requires, and otherwise its default.
+func (c *Configuration) xdgBase(xdg xdgDir) string {
+	if base, ok := c.Metadata.environment.LookupEnv(xdg.env); ok && filepath.IsAbs(base) {
+		return base
+	}
+	if runtime.GOOS == "windows" {
+		if base, err := xdg.fallback(); err == nil {
+			return base
+		}
+	}
+	return filepath.Join(c.Metadata.homeDir, xdg.home)
+}
+
+// makeDir creates dir, readable only by the user, if it does not exist.
+func makeDir(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// DataDir returns the directory for the application's data files, creating
+// it if needed. It is $XDG_DATA_HOME/<app>, by default ~/.local/share/<app>.
+func (m *configurationMetadata) DataDir() (string, error) {
+	return makeDir(m.dataDir)
+}
+
+// CacheDir returns the directory for the application's cached files,
+// creating it if needed. It is $XDG_CACHE_HOME/<app>, by default
+// ~/.cache/<app>.
+func (m *configurationMetadata) CacheDir() (string, error) {
+	return makeDir(m.cacheDir)
+}
+
+// StateDir returns the directory for state that persists across runs, such
+// as logs and history, creating it if needed. It is $XDG_STATE_HOME/<app>, by
+// default ~/.local/state/<app>.
+func (m *configurationMetadata) StateDir() (string, error) {
+	return makeDir(m.stateDir)
+}
+
+// RuntimeDir returns the directory for sockets and other files that only live
+// as long as the user's session, creating it if needed. It is
+// $XDG_RUNTIME_DIR/<app>, or a private directory under the system temporary
+// directory when that is unset. As another user can create that directory
+// first, it is refused unless it is a directory owned by the user and
+// accessible only to them.
+func (m *configurationMetadata) RuntimeDir() (string, error) {
+	dir, err := makeDir(m.runtimeDir)
+	if err != nil || !m.runtimeShared {
+		return dir, err
+	}
+	if err = checkPrivateDir(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// ****** Options *************************************************************
+
+func ConfigurationOptionDataDir(dataDir string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.dataDir = dataDir
+		return nil
+	}
+}
+func ConfigurationOptionCacheDir(cacheDir string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.cacheDir = cacheDir
+		return nil
+	}
+}
+func ConfigurationOptionStateDir(stateDir string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.stateDir = stateDir
+		return nil
+	}
+}
+func ConfigurationOptionRuntimeDir(runtimeDir string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.runtimeDir = runtimeDir
+		return nil
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+// checkPrivateDir accepts dir. Outside unix the temporary directory is
+// already private to the user.
+func checkPrivateDir(dir string) error {
+	return nil
+}
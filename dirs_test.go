@@ -0,0 +1,208 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapEnv map[string]string
+
+func (e mapEnv) LookupEnv(key string) (string, bool) {
+	value, ok := e[key]
+	return value, ok
+}
+func (e mapEnv) Setenv(key string, value string) error {
+	e[key] = value
+	return nil
+}
+func (e mapEnv) Unsetenv(key string) error {
+	delete(e, key)
+	return nil
+}
+
+func Test_Dirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG defaults do not apply on windows")
+	}
+	base := t.TempDir()
+	tests := map[string]struct {
+		env     mapEnv
+		options []ConfigurationOption
+		config  string
+		data    string
+		cache   string
+		state   string
+		runtime string
+	}{
+		"XDG": {
+			env: mapEnv{
+				"XDG_CONFIG_HOME": base + "/config",
+				"XDG_DATA_HOME":   base + "/data",
+				"XDG_CACHE_HOME":  base + "/cache",
+				"XDG_STATE_HOME":  base + "/state",
+				"XDG_RUNTIME_DIR": base + "/run",
+			},
+			config:  base + "/config/demo",
+			data:    base + "/data/demo",
+			cache:   base + "/cache/demo",
+			state:   base + "/state/demo",
+			runtime: base + "/run/demo",
+		},
+		"Relative paths ignored": {
+			env:     mapEnv{"XDG_DATA_HOME": "data", "XDG_RUNTIME_DIR": "run"},
+			options: []ConfigurationOption{ConfigurationOptionDataDir(base + "/opt/data")},
+			data:    base + "/opt/data",
+			runtime: filepath.Join(os.TempDir(), fmt.Sprintf("demo-%d", os.Getuid())),
+		},
+		"Options": {
+			env: mapEnv{"XDG_CACHE_HOME": base + "/cache"},
+			options: []ConfigurationOption{
+				ConfigurationOptionConfigDir(base + "/o/config"),
+				ConfigurationOptionCacheDir(base + "/o/cache"),
+				ConfigurationOptionStateDir(base + "/o/state"),
+				ConfigurationOptionRuntimeDir(base + "/o/run"),
+			},
+			config:  base + "/o/config",
+			cache:   base + "/o/cache",
+			state:   base + "/o/state",
+			runtime: base + "/o/run",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &managedConfig{Name: "x"}
+			options := append([]ConfigurationOption{
+				configurationOptionNoLoad(),
+				configurationOptionNoWatch(),
+				ConfigurationOptionAppName("/usr/bin/demo"),
+				ConfigurationOptionEnvironment(test.env),
+			}, test.options...)
+			if !assert.NoError(t, InitConfig(context.Background(), config, options...)) {
+				return
+			}
+			m := config.Core.Metadata
+			home := m.HomeDir()
+			expect := func(expected string, fallback string) string {
+				if expected == "" {
+					return filepath.Join(home, fallback, "demo")
+				}
+				return expected
+			}
+			assert.Equal(t, expect(test.config, ".config"), m.ConfigDir())
+			assert.Equal(t, expect(test.data, ".local/share"), m.dataDir)
+			assert.Equal(t, expect(test.cache, ".cache"), m.cacheDir)
+			assert.Equal(t, expect(test.state, ".local/state"), m.stateDir)
+			assert.Equal(t, test.runtime, m.runtimeDir)
+		})
+	}
+}
+
+func Test_DirsCreated(t *testing.T) {
+	base := t.TempDir()
+	config := &managedConfig{Name: "x"}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoLoad(),
+		configurationOptionNoWatch(),
+		ConfigurationOptionAppName("demo"),
+		ConfigurationOptionEnvironment(mapEnv{"XDG_STATE_HOME": base + "/state", "XDG_RUNTIME_DIR": base + "/run"}),
+	)
+	assert.NoError(t, err)
+
+	for _, dir := range []func() (string, error){config.Core.Metadata.StateDir, config.Core.Metadata.RuntimeDir} {
+		path, err := dir()
+		if assert.NoError(t, err) {
+			info, err := os.Stat(path)
+			if assert.NoError(t, err) && runtime.GOOS != "windows" {
+				assert.True(t, info.IsDir())
+				assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+			}
+		}
+	}
+}
+
+func Test_RuntimeDirShared(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the temporary directory is private on windows")
+	}
+	tests := map[string]struct {
+		prepare func(dir string) error
+		expect  string
+	}{
+		"Created": {
+			prepare: func(dir string) error { return nil },
+		},
+		"Open mode": {
+			prepare: func(dir string) error {
+				if err := os.Mkdir(dir, 0o700); err != nil {
+					return err
+				}
+				return os.Chmod(dir, 0o755)
+			},
+			expect: "mode 0755, expected 0700",
+		},
+		"Symlink": {
+			prepare: func(dir string) error {
+				target := dir + ".target"
+				if err := os.Mkdir(target, 0o700); err != nil {
+					return err
+				}
+				return os.Symlink(target, dir)
+			},
+			expect: "not a directory",
+		},
+		"Other owner": {
+			prepare: func(dir string) error {
+				if os.Getuid() != 0 {
+					t.Skip("changing the owner needs root")
+				}
+				if err := os.Mkdir(dir, 0o700); err != nil {
+					return err
+				}
+				return os.Chown(dir, os.Getuid()+1, -1)
+			},
+			expect: "owned by another user",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+			dir := filepath.Join(tmp, fmt.Sprintf("demo-%d", os.Getuid()))
+			if err := test.prepare(dir); err != nil {
+				t.Fatal(err)
+			}
+			config := &managedConfig{Name: "x"}
+			err := InitConfig(
+				context.Background(), config,
+				configurationOptionNoLoad(),
+				configurationOptionNoWatch(),
+				ConfigurationOptionAppName("demo"),
+				ConfigurationOptionEnvironment(mapEnv{}),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			path, err := config.Core.Metadata.RuntimeDir()
+			if test.expect == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, dir, path)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equal(t, dir+": "+test.expect, err.Error())
+			}
+			assert.Empty(t, path)
+		})
+	}
+}
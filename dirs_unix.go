@@ -0,0 +1,32 @@
+//go:build unix
+
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPrivateDir reports an error unless dir is a directory, not a link to
+// one, owned by the user and accessible only to them.
+func checkPrivateDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", dir)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s: owned by another user", dir)
+	}
+	if info.Mode().Perm() != 0o700 {
+		return fmt.Errorf("%s: mode %04o, expected 0700", dir, info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,680 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+type position struct {
+	file     string
+	line     int
+	column   int
+	defaults bool
+}
+
+// document is a parsed configuration file. Both YAML and JSON sources are
+// held as a yaml.Node tree so that every value keeps its line and column.
+type document struct {
+	file       string
+	format     string
+	root       *yaml.Node
+	positions  map[string]position
+	env        Environment
+	ignoreCase bool
+	// rt is the type of the configuration, used to find the key a setting
+	// has in a JSON document.
+	rt reflect.Type
+}
+
+// ****** Parsing *************************************************************
+
+func parseDocument(file string, format string, bs []byte) (*document, error) {
+	d := &document{file: file, format: format, positions: make(map[string]position)}
+	switch format {
+	case "json":
+		root, err := parseJSON(bs)
+		if err != nil {
+			return nil, d.syntaxError(bs, err)
+		}
+		d.root = root
+	default:
+		root := &yaml.Node{}
+		if err := yaml.Unmarshal(bs, root); err != nil {
+			return nil, &InvalidInitConfigError{Code: ErrUnmarshalCoreConfig, File: file, err: err}
+		}
+		d.root = root
+	}
+	return d, nil
+}
+
+func (d *document) syntaxError(bs []byte, err error) error {
+	e := &InvalidInitConfigError{Code: ErrUnmarshalCoreConfig, File: d.file, err: err}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		e.Line, e.Column = lineColumn(lineOffsets(bs), int(syntaxErr.Offset))
+	}
+	return e
+}
+
+// parseJSON converts a JSON document into a yaml.Node tree, translating the
+// decoder's byte offsets into line and column positions as it goes.
+func parseJSON(bs []byte) (*yaml.Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	lines := lineOffsets(bs)
+	node, err := jsonNode(dec, bs, lines)
+	if err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Column: 1, Content: []*yaml.Node{node}}, nil
+}
+
+func jsonNode(dec *json.Decoder, bs []byte, lines []int) (*yaml.Node, error) {
+	offset := skipJSONSpace(bs, int(dec.InputOffset()))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	node := &yaml.Node{}
+	node.Line, node.Column = lineColumn(lines, offset)
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		case '[':
+			node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		}
+		for dec.More() {
+			child, err := jsonNode(dec, bs, lines)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		node.Kind, node.Tag, node.Value, node.Style = yaml.ScalarNode, "!!str", t, yaml.DoubleQuotedStyle
+	case json.Number:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!int", t.String()
+		if strings.ContainsAny(node.Value, ".eE") {
+			node.Tag = "!!float"
+		}
+	case bool:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!bool", strconv.FormatBool(t)
+	case nil:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!null", "null"
+	}
+	return node, nil
+}
+
+func skipJSONSpace(bs []byte, offset int) int {
+	for offset < len(bs) && strings.IndexByte(" \t\r\n:,", bs[offset]) != -1 {
+		offset++
+	}
+	return offset
+}
+
+func lineOffsets(bs []byte) []int {
+	lines := []int{0}
+	for i, b := range bs {
+		if b == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func lineColumn(lines []int, offset int) (int, int) {
+	line := sort.Search(len(lines), func(i int) bool { return lines[i] > offset })
+	return line, offset - lines[line-1] + 1
+}
+
+// ****** Checking ************************************************************
+
+// check walks the document against the configuration type, recording the
+// position of every setting, expanding ${VAR} references and reporting
+// unknown keys and values that cannot be decoded into their field. Every
+// problem found is reported, as an ErrorList when there is more than one.
+func (d *document) check(rt reflect.Type) error {
+	if d.root == nil || len(d.root.Content) == 0 {
+		return nil
+	}
+	return d.checkNode(d.root.Content[0], rt, "")
+}
+
+func (d *document) checkNode(node *yaml.Node, rt reflect.Type, path string) error {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if path != "" {
+		d.positions[path] = position{file: d.file, line: node.Line, column: node.Column}
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+
+	var errs []error
+	switch {
+	case isLeafType(rt) && rt.Kind() != reflect.Slice && rt.Kind() != reflect.Map:
+		if err := d.interpolate(node, path); err != nil {
+			return err
+		}
+		if rt.Kind() == reflect.Interface {
+			return nil
+		}
+		if node.Kind != yaml.ScalarNode || node.Decode(reflect.New(rt).Interface()) != nil {
+			return d.errorAt(node, ErrTypeCoreConfig, path, "expected %s", typeName(rt))
+		}
+	case rt.Kind() == reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return d.errorAt(node, ErrTypeCoreConfig, path, "expected %s", typeName(rt))
+		}
+		for i, child := range node.Content {
+			errs = appendError(errs, d.checkNode(child, rt.Elem(), fmt.Sprintf("%s[%d]", path, i)))
+		}
+	case rt.Kind() == reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return d.errorAt(node, ErrTypeCoreConfig, path, "expected %s", typeName(rt))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			errs = appendError(errs, d.checkNode(node.Content[i+1], rt.Elem(), joinPath(path, node.Content[i].Value)))
+		}
+	default:
+		if node.Kind != yaml.MappingNode {
+			return d.errorAt(node, ErrTypeCoreConfig, path, "expected %s", typeName(rt))
+		}
+		fields := settingFields(rt, d.format)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, ok := fields[key.Value]
+			// encoding/json matches keys regardless of case.
+			if !ok && (d.ignoreCase || d.format == "json") {
+				for name, f := range fields {
+					if strings.EqualFold(name, key.Value) {
+						// The key is given the field's own name so it decodes.
+						key.Value, field, ok = name, f, true
+						break
+					}
+				}
+			}
+			if !ok {
+				errs = append(errs, d.errorAt(key, ErrUnknownKeyCoreConfig, joinPath(path, key.Value), "unknown key"))
+				continue
+			}
+			errs = appendError(errs, d.checkNode(node.Content[i+1], field.Type, joinPath(path, field.name)))
+		}
+	}
+	return joinErrors(errs)
+}
+
+// decode decodes the document into v. A JSON document is decoded with
+// encoding/json, so that json tags and Unmarshaler implementations apply.
+func (d *document) decode(v interface{}) error {
+	if d.root == nil || d.root.Kind == 0 {
+		return nil
+	}
+	if d.format != "json" {
+		return d.root.Decode(v)
+	}
+	bs, err := d.encode()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// interpolate expands ${VAR} and ${VAR:-default} references in a scalar from
+// the environment. A literal "${" is written as "$${".
+func (d *document) interpolate(node *yaml.Node, path string) error {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		for i, child := range node.Content {
+			childPath := path
+			if node.Kind == yaml.SequenceNode {
+				childPath = fmt.Sprintf("%s[%d]", path, i)
+			} else if i%2 == 0 {
+				continue
+			} else {
+				childPath = joinPath(path, node.Content[i-1].Value)
+			}
+			if err := d.interpolate(child, childPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if node.Kind != yaml.ScalarNode || !strings.Contains(node.Value, "${") {
+		return nil
+	}
+
+	var sb strings.Builder
+	value := node.Value
+	for {
+		index := strings.Index(value, "${")
+		if index == -1 {
+			sb.WriteString(value)
+			break
+		}
+		if index > 0 && value[index-1] == '$' {
+			sb.WriteString(value[:index-1] + "${")
+			value = value[index+2:]
+			continue
+		}
+		end := strings.Index(value[index:], "}")
+		if end == -1 {
+			return d.errorAt(node, ErrInterpolateCoreConfig, path, "unterminated reference in %q", node.Value)
+		}
+		sb.WriteString(value[:index])
+		name, def, hasDef := strings.Cut(value[index+2:index+end], ":-")
+		if v, ok := d.lookupEnv(name); ok {
+			sb.WriteString(v)
+		} else if hasDef {
+			sb.WriteString(def)
+		} else {
+			return d.errorAt(node, ErrInterpolateCoreConfig, path, "undefined variable %s", name)
+		}
+		value = value[index+end+1:]
+	}
+	node.Value = sb.String()
+	if node.Style == 0 {
+		node.Tag = ""
+	}
+	return nil
+}
+
+func (d *document) lookupEnv(name string) (string, bool) {
+	if d.env == nil {
+		return os.LookupEnv(name)
+	}
+	return d.env.LookupEnv(name)
+}
+
+func (d *document) errorAt(node *yaml.Node, code ErrorCode, path string, format string, args ...interface{}) error {
+	return &InvalidInitConfigError{
+		Code:   code,
+		File:   d.file,
+		Line:   node.Line,
+		Column: node.Column,
+		Path:   path,
+		err:    fmt.Errorf(format, args...),
+	}
+}
+
+// ****** Writing *************************************************************
+
+// set replaces the value at a dotted path, creating any missing mappings on
+// the way. The comments around an existing value, and the quoting of an
+// existing scalar, are kept.
+func (d *document) set(path string, value interface{}) error {
+	valueNode := &yaml.Node{}
+	if err := valueNode.Encode(value); err != nil {
+		return err
+	}
+	return d.setNode(path, valueNode)
+}
+
+func (d *document) setNode(path string, valueNode *yaml.Node) error {
+	if d.root == nil || len(d.root.Content) == 0 {
+		d.root = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	node := d.root.Content[0]
+	keys := d.fileKeys(path)
+	for i, key := range keys {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind != yaml.MappingNode {
+			return d.errorAt(node, ErrTypeCoreConfig, strings.Join(strings.Split(path, ".")[:i], "."), "expected mapping")
+		}
+		var child *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if d.keyIs(node.Content[j].Value, key) {
+				child = node.Content[j+1]
+			}
+		}
+		last := i == len(keys)-1
+		switch {
+		case child == nil && last:
+			child = valueNode
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		case child == nil:
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		case last:
+			replaceNode(child, valueNode)
+		}
+		node = child
+	}
+	return nil
+}
+
+// rename moves the values found at the old paths of aliases to their new
+// paths, returning the key nodes of the old paths that were found. A key
+// renamed within the same mapping keeps its place and comments. When the new
+// path is also present, it wins and the old one is dropped.
+func (d *document) rename(aliases map[string]string) (map[string]*yaml.Node, error) {
+	renamed := make(map[string]*yaml.Node)
+	if d.root == nil || len(d.root.Content) == 0 {
+		return renamed, nil
+	}
+	for oldPath, newPath := range aliases {
+		parent, index := d.lookup(oldPath)
+		if parent == nil {
+			continue
+		}
+		keyNode, valueNode := parent.Content[index], parent.Content[index+1]
+		renamed[oldPath] = keyNode
+		oldParent, _ := splitPath(oldPath)
+		newParent, _ := splitPath(newPath)
+		if existing, _ := d.lookup(newPath); existing != nil {
+			parent.Content = append(parent.Content[:index], parent.Content[index+2:]...)
+			continue
+		}
+		if oldParent == newParent {
+			keys := d.fileKeys(newPath)
+			keyNode.Value = keys[len(keys)-1]
+			continue
+		}
+		parent.Content = append(parent.Content[:index], parent.Content[index+2:]...)
+		if err := d.setNode(newPath, valueNode); err != nil {
+			return nil, err
+		}
+	}
+	return renamed, nil
+}
+
+// keyIs reports whether a key in the document is the given key. encoding/json
+// matches keys regardless of case.
+func (d *document) keyIs(key string, name string) bool {
+	return key == name || ((d.ignoreCase || d.format == "json") && strings.EqualFold(key, name))
+}
+
+// fileKeys splits a dotted setting path into the keys it has in the
+// document. A JSON document knows a struct field by its json tag.
+func (d *document) fileKeys(path string) []string {
+	keys := strings.Split(path, ".")
+	if d.format != "json" || d.rt == nil {
+		return keys
+	}
+	rt := d.rt
+	for i, name := range keys {
+		for rt.Kind() == reflect.Pointer {
+			rt = rt.Elem()
+		}
+		switch {
+		case rt.Kind() == reflect.Map:
+			rt = rt.Elem()
+		case rt.Kind() == reflect.Struct && !isLeafType(rt):
+			found := false
+			for key, field := range settingFields(rt, d.format) {
+				if field.name == name {
+					keys[i], rt, found = key, field.Type, true
+					break
+				}
+			}
+			if !found {
+				return keys
+			}
+		default:
+			return keys
+		}
+	}
+	return keys
+}
+
+// splitPath splits a dotted path into the path of its parent and its key.
+func splitPath(path string) (string, string) {
+	if index := strings.LastIndex(path, "."); index != -1 {
+		return path[:index], path[index+1:]
+	}
+	return "", path
+}
+
+// lookup finds the mapping holding the dotted path and the index of its key.
+func (d *document) lookup(path string) (*yaml.Node, int) {
+	node := d.root.Content[0]
+	keys := d.fileKeys(path)
+	for i, key := range keys {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil, 0
+		}
+		found := false
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if d.keyIs(node.Content[j].Value, key) {
+				if i == len(keys)-1 {
+					return node, j
+				}
+				node, found = node.Content[j+1], true
+				break
+			}
+		}
+		if !found {
+			return nil, 0
+		}
+	}
+	return nil, 0
+}
+
+func replaceNode(dst *yaml.Node, src *yaml.Node) {
+	if dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode {
+		if dst.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 && src.Tag != "!!str" {
+			dst.Style = 0
+		}
+		dst.Value, dst.Tag = src.Value, src.Tag
+		return
+	}
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+}
+
+// encode renders the document in the format it was read in.
+func (d *document) encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if d.format == "json" {
+		if d.root != nil && len(d.root.Content) > 0 {
+			if err := writeJSON(buf, d.root.Content[0], ""); err != nil {
+				return nil, err
+			}
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSON writes a node as indented JSON, keeping the order of its keys.
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "{", "}", 2
+		if node.Kind == yaml.SequenceNode {
+			open, close, step = "[", "]", 1
+		}
+		if len(node.Content) == 0 {
+			buf.WriteString(open + close)
+			return nil
+		}
+		buf.WriteString(open + "\n")
+		for i := 0; i < len(node.Content); i += step {
+			buf.WriteString(indent + "  ")
+			if step == 2 {
+				key, _ := json.Marshal(node.Content[i].Value)
+				buf.Write(key)
+				buf.WriteString(": ")
+			}
+			if err := writeJSON(buf, node.Content[i+step-1], indent+"  "); err != nil {
+				return err
+			}
+			if i+step < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + close)
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		bs, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(bs)
+	}
+	return nil
+}
+
+// ****** Setting names *******************************************************
+
+// settingName returns the key a struct field is known by in a configuration
+// file. Inline fields contribute their own settings to the parent's keys.
+func settingName(parent reflect.Type, ft reflect.StructField) (name string, inline bool, ok bool) {
+	if !ft.IsExported() && !isInternalType(parent) && ft.Type != configurationTypePtr {
+		return "", false, false
+	}
+	if ft.Type.Kind() == reflect.Func || ft.Type.Kind() == reflect.Chan {
+		return "", false, false
+	}
+	tag := ft.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, flags, _ := strings.Cut(tag, ",")
+	if strings.Contains(","+flags+",", ",inline,") || (ft.Anonymous && name == "" && isInternalType(ft.Type)) {
+		return "", true, true
+	}
+	if name == "" {
+		name = strings.ToLower(ft.Name)
+	}
+	return name, false, true
+}
+
+// settingField is a struct field and the setting name it is known by.
+type settingField struct {
+	reflect.StructField
+	name string
+}
+
+// settingFields returns the fields of a struct by the key each has in a file
+// of the given format. A JSON file uses the json tag where there is one, as
+// encoding/json does.
+func settingFields(rt reflect.Type, format string) map[string]settingField {
+	fields := make(map[string]settingField)
+	for i := 0; i < rt.NumField(); i++ {
+		ft := rt.Field(i)
+		name, inline, ok := settingName(rt, ft)
+		if !ok {
+			continue
+		}
+		if inline {
+			it := ft.Type
+			for it.Kind() == reflect.Pointer {
+				it = it.Elem()
+			}
+			for k, v := range settingFields(it, format) {
+				fields[k] = v
+			}
+			continue
+		}
+		key := name
+		if format == "json" {
+			tag, _, _ := strings.Cut(ft.Tag.Get("json"), ",")
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				key = tag
+			}
+		}
+		fields[key] = settingField{StructField: ft, name: name}
+	}
+	return fields
+}
+
+func isInternalType(rt reflect.Type) bool {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	return rt.PkgPath() == configurationType.PkgPath()
+}
+
+func isLeafType(rt reflect.Type) bool {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return true
+	}
+	return !isInternalType(rt) && reflect.PointerTo(rt).Implements(textUnmarshalerType)
+}
+
+func typeName(rt reflect.Type) string {
+	if rt == durationType {
+		return "duration"
+	}
+	switch rt.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		if rt.Kind() == reflect.Struct && isLeafType(rt) {
+			return rt.String()
+		}
+		return "mapping"
+	default:
+		return rt.Kind().String()
+	}
+}
+
+func joinPath(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
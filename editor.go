@@ -0,0 +1,747 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jfigge/clif/constants/color"
+	"github.com/jfigge/clif/constants/cursor"
+	"github.com/jfigge/clif/constants/keys"
+	"github.com/jfigge/clif/constants/screen"
+	"golang.org/x/term"
+)
+
+const (
+	widgetText = iota
+	widgetChoice
+	widgetList
+)
+
+// editorRow is a line of the settings editor: the heading of a section, or
+// a setting.
+type editorRow struct {
+	section string
+	depth   int
+	s       *setting
+}
+
+// editorWidget edits the value of a single setting: free text, a choice
+// between the values allowed, or the items of a list.
+type editorWidget struct {
+	s       *setting
+	kind    int
+	input   []rune
+	choices []string
+	choice  int
+	items   []string
+	item    int
+}
+
+type settingsEditor struct {
+	c         *Configuration
+	rows      []editorRow
+	collapsed map[string]bool
+	cursor    int
+	top       int
+	width     int
+	height    int
+	edits     map[string]string
+	errors    map[string]string
+	widget    *editorWidget
+	message   string
+	quitting  bool
+}
+
+// ****** Editor **************************************************************
+
+// EditSettings opens a full-screen editor of the settings on the terminal.
+// Settings are grouped in sections that open and close, each showing its
+// value and where the value came from. Changes are made with an input suited
+// to the setting, checked as they are typed, and applied together the way a
+// reload is, so the OnReload hooks and the monitors of each setting see them.
+// Applied changes can also be written to the configuration file.
+func (c *Configuration) EditSettings(ctx context.Context) error {
+	readKey := c.Metadata.readKey
+	size := func() (int, int) { return 80, 24 }
+	if readKey == nil {
+		var stop func()
+		var err error
+		if readKey, stop, err = c.terminalKeys(ctx); err != nil {
+			return err
+		}
+		defer stop()
+		size = terminalSize(c.Metadata.input)
+	}
+
+	e := c.newSettingsEditor()
+	out := c.Metadata.output
+	for {
+		e.width, e.height = size()
+		fmt.Fprint(out, e.render())
+		key, err := readKey(ctx)
+		if err != nil {
+			return err
+		}
+		if !e.handle(ctx, key) {
+			fmt.Fprint(out, fmt.Sprintf(screen.SetPosition, 1, 1)+screen.ClearDown)
+			return nil
+		}
+	}
+}
+
+// terminalSize returns a function reporting the size of the terminal input is
+// read from, or 80x24 when input is not a terminal.
+func terminalSize(input io.Reader) func() (int, int) {
+	f, ok := input.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return func() (int, int) { return 80, 24 }
+	}
+	fd := int(f.Fd())
+	return func() (int, int) {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			return 80, 24
+		}
+		return width, height
+	}
+}
+
+// newSettingsEditor lays out the settings of the application, with a heading
+// for each section as it starts.
+func (c *Configuration) newSettingsEditor() *settingsEditor {
+	e := &settingsEditor{c: c, collapsed: make(map[string]bool), edits: make(map[string]string), errors: make(map[string]string)}
+	var previous []string
+	for _, s := range c.settings {
+		if s.command != nil {
+			continue
+		}
+		parents := strings.Split(s.path, ".")
+		parents = parents[:len(parents)-1]
+		shared := 0
+		for shared < len(previous) && shared < len(parents) && previous[shared] == parents[shared] {
+			shared++
+		}
+		for i := shared; i < len(parents); i++ {
+			e.rows = append(e.rows, editorRow{section: strings.Join(parents[:i+1], "."), depth: i})
+		}
+		e.rows = append(e.rows, editorRow{s: s, depth: len(parents)})
+		previous = parents
+	}
+	return e
+}
+
+// applyEdits applies the edits, text keyed by setting path, as a reload
+// would: over the file, environment and command line, and over the values
+// already set in memory. Nothing is applied unless every edit is valid.
+func (c *Configuration) applyEdits(ctx context.Context, edits map[string]string) error {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	bs, err := c.readConfigFile()
+	if err != nil {
+		return err
+	}
+	fresh, err := c.loadInstance(c.Metadata.configFile, bs, true)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	for _, s := range c.settings {
+		if f := fresh.setting(s.path); f != nil && s.command == nil && s.source == sourceSet {
+			f.value.Set(s.value)
+			f.source = sourceSet
+		}
+	}
+	c.lock.Unlock()
+
+	var errs []error
+	paths := make([]string, 0, len(edits))
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		f := fresh.setting(path)
+		if f == nil {
+			errs = append(errs, &InvalidInitConfigError{Code: ErrUnknownKeyCoreConfig, Path: path, err: fmt.Errorf("unknown setting")})
+			continue
+		}
+		fv, err := f.parse(edits[path])
+		if err != nil {
+			errs = append(errs, &InvalidInitConfigError{Code: ErrValidateCoreConfig, Path: path, err: err})
+			continue
+		}
+		f.value.Set(fv)
+		f.source = sourceSet
+	}
+	if err = joinErrors(errs); err != nil {
+		return err
+	}
+	// loadInstance has already run SetDefaults and Normalize; only the
+	// validation is repeated with the edits in place.
+	if err = fresh.validateLoad(); err != nil {
+		return err
+	}
+	_, err = c.apply(ctx, fresh, bs, auditEdit)
+	return err
+}
+
+// ****** Keys ****************************************************************
+
+// handle acts on a key, returning false once the editor is closed.
+func (e *settingsEditor) handle(ctx context.Context, key keys.Key) bool {
+	if e.widget != nil {
+		e.handleWidget(key)
+		return true
+	}
+	quitting := e.quitting
+	e.quitting = false
+	e.message = ""
+	row := e.row()
+	switch code := key.Ascii(); key.Modifier() {
+	case keys.ModifierControl:
+		switch code {
+		case 'C':
+			return false
+		case 'M', 'J':
+			e.open(row)
+		}
+	case keys.Up.Modifier():
+		e.move(-1)
+	case keys.Down.Modifier():
+		e.move(1)
+	case keys.Left.Modifier():
+		e.close(row)
+	case keys.Right.Modifier():
+		if row.s == nil {
+			e.collapsed[row.section] = false
+		}
+	case keys.ModifierNone:
+		switch code {
+		case 'k':
+			e.move(-1)
+		case 'j':
+			e.move(1)
+		case 'h':
+			e.close(row)
+		case 'l':
+			if row.s == nil {
+				e.collapsed[row.section] = false
+			}
+		case ' ':
+			e.open(row)
+		case 'u':
+			if row.s != nil {
+				delete(e.edits, row.s.path)
+				delete(e.errors, row.s.path)
+			}
+		case 'a':
+			e.apply(ctx, false)
+		case 'w':
+			e.apply(ctx, true)
+		case 'q', 27:
+			if len(e.edits) == 0 || quitting {
+				return false
+			}
+			e.quitting = true
+			e.message = fmt.Sprintf("%d unapplied changes, press q again to discard them", len(e.edits))
+		}
+	}
+	return true
+}
+
+// handleWidget passes a key to the widget being edited.
+func (e *settingsEditor) handleWidget(key keys.Key) {
+	w := e.widget
+	switch code := key.Ascii(); key.Modifier() {
+	case keys.ModifierControl:
+		switch code {
+		case 'M', 'J':
+			if _, err := w.s.parse(w.text()); err == nil {
+				e.stage(w.s, w.text())
+				e.widget = nil
+			}
+		case 'C':
+			e.widget = nil
+		case 'H':
+			w.erase()
+		case 'U':
+			w.clear()
+		case 'I':
+			w.next()
+		}
+	case keys.Up.Modifier():
+		w.step(-1)
+	case keys.Down.Modifier():
+		w.step(1)
+	case keys.Left.Modifier():
+		if w.kind == widgetChoice {
+			w.step(-1)
+		}
+	case keys.Right.Modifier():
+		if w.kind == widgetChoice {
+			w.step(1)
+		}
+	case keys.ModifierNone:
+		switch {
+		case code == 27:
+			e.widget = nil
+		case code == 127:
+			w.erase()
+		case unicode.IsPrint(code):
+			w.insert(code)
+		}
+	}
+}
+
+// visible returns the indexes of the rows outside closed sections.
+func (e *settingsEditor) visible() []int {
+	var rows []int
+	for i, row := range e.rows {
+		path := row.section
+		if row.s != nil {
+			path = row.s.path
+		}
+		hidden := false
+		for section, closed := range e.collapsed {
+			if closed && strings.HasPrefix(path, section+".") {
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+func (e *settingsEditor) row() editorRow {
+	if len(e.rows) == 0 {
+		return editorRow{}
+	}
+	return e.rows[e.cursor]
+}
+
+// move moves the cursor to the next, or previous, visible row.
+func (e *settingsEditor) move(step int) {
+	rows := e.visible()
+	i := slices.Index(rows, e.cursor) + step
+	if i >= 0 && i < len(rows) {
+		e.cursor = rows[i]
+	}
+}
+
+// close closes the section under the cursor, or moves the cursor to the
+// heading of the section it is in.
+func (e *settingsEditor) close(row editorRow) {
+	if row.s == nil && row.section != "" && !e.collapsed[row.section] {
+		e.collapsed[row.section] = true
+		return
+	}
+	for i := e.cursor - 1; i >= 0; i-- {
+		if e.rows[i].s == nil && e.rows[i].depth < row.depth {
+			e.cursor = i
+			return
+		}
+	}
+}
+
+// open opens or closes a section, toggles a flag, or starts editing the
+// setting under the cursor with the widget that suits it.
+func (e *settingsEditor) open(row editorRow) {
+	if row.s == nil {
+		if row.section != "" {
+			e.collapsed[row.section] = !e.collapsed[row.section]
+		}
+		return
+	}
+	e.c.lock.Lock()
+	text, ok := e.edits[row.s.path]
+	if !ok {
+		text = formatValue(row.s.value)
+	}
+	e.c.lock.Unlock()
+
+	w := &editorWidget{s: row.s, input: []rune(text), choices: enumValues(row.s.validate)}
+	switch kind := row.s.field.Type.Kind(); {
+	case kind == reflect.Bool:
+		value := "true"
+		if text == "true" {
+			value = "false"
+		}
+		e.stage(row.s, value)
+		return
+	case w.choices != nil:
+		w.kind = widgetChoice
+		w.choice = max(slices.Index(w.choices, text), 0)
+	case kind == reflect.Slice:
+		w.kind = widgetList
+		if text != "" {
+			w.items = strings.Split(text, ",")
+		}
+	}
+	e.widget = w
+}
+
+// stage records an edit to apply, dropping it when it restores the value in
+// use.
+func (e *settingsEditor) stage(s *setting, text string) {
+	e.c.lock.Lock()
+	current := formatValue(s.value)
+	e.c.lock.Unlock()
+	delete(e.errors, s.path)
+	if text == current {
+		delete(e.edits, s.path)
+		return
+	}
+	e.edits[s.path] = text
+}
+
+// apply applies the edits and, when save is set, writes every setting set in
+// memory to the configuration file. Errors naming a setting are shown beside
+// it.
+func (e *settingsEditor) apply(ctx context.Context, save bool) {
+	if len(e.edits) == 0 && !save {
+		e.message = "nothing to apply"
+		return
+	}
+	clear(e.errors)
+	if len(e.edits) > 0 {
+		if err := e.c.applyEdits(ctx, e.edits); err != nil {
+			e.showError(err)
+			return
+		}
+	}
+	applied := len(e.edits)
+	clear(e.edits)
+	e.message = fmt.Sprintf("applied %d changes", applied)
+	if !save {
+		return
+	}
+	var paths []string
+	e.c.lock.Lock()
+	for _, s := range e.c.settings {
+		if _, override := e.c.sets[s.path]; s.command == nil && s.source == sourceSet && !override {
+			paths = append(paths, s.path)
+		}
+	}
+	e.c.lock.Unlock()
+	if err := e.c.persist(paths...); err != nil {
+		e.showError(err)
+		return
+	}
+	e.message = fmt.Sprintf("applied %d changes, saved %s", applied, e.c.Metadata.configFile)
+}
+
+func (e *settingsEditor) showError(err error) {
+	errs := []error{err}
+	var list ErrorList
+	if errors.As(err, &list) {
+		errs = list
+	}
+	for _, err := range errs {
+		var ie *InvalidInitConfigError
+		if errors.As(err, &ie) && ie.Path != "" && ie.err != nil && e.c.setting(ie.Path) != nil {
+			e.errors[ie.Path] = ie.err.Error()
+			continue
+		}
+		e.message = err.Error()
+	}
+	if e.message == "" {
+		e.message = "changes not applied"
+	}
+}
+
+// ****** Widgets *************************************************************
+
+// text returns the value being edited, as accepted by setFromString.
+func (w *editorWidget) text() string {
+	switch w.kind {
+	case widgetChoice:
+		return w.choices[w.choice]
+	case widgetList:
+		var items []string
+		for _, item := range w.items {
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ",")
+	}
+	return string(w.input)
+}
+
+// insert types r into the text, or into the current item of a list, adding
+// an item when on the last line.
+func (w *editorWidget) insert(r rune) {
+	switch w.kind {
+	case widgetText:
+		w.input = append(w.input, r)
+	case widgetList:
+		if r == ',' {
+			return
+		}
+		if w.item == len(w.items) {
+			w.items = append(w.items, "")
+		}
+		w.items[w.item] += string(r)
+	}
+}
+
+// erase removes the last character of the text, or of the current item of a
+// list, and the item itself once it is empty.
+func (w *editorWidget) erase() {
+	switch w.kind {
+	case widgetText:
+		if len(w.input) > 0 {
+			w.input = w.input[:len(w.input)-1]
+		}
+	case widgetList:
+		if w.item == len(w.items) {
+			return
+		}
+		if item := []rune(w.items[w.item]); len(item) > 0 {
+			w.items[w.item] = string(item[:len(item)-1])
+		} else {
+			w.items = slices.Delete(w.items, w.item, w.item+1)
+		}
+	}
+}
+
+func (w *editorWidget) clear() {
+	switch w.kind {
+	case widgetText:
+		w.input = nil
+	case widgetList:
+		if w.item < len(w.items) {
+			w.items[w.item] = ""
+		}
+	}
+}
+
+// step moves between the choices, or the items of a list.
+func (w *editorWidget) step(step int) {
+	switch w.kind {
+	case widgetChoice:
+		w.choice = (w.choice + step + len(w.choices)) % len(w.choices)
+	case widgetList:
+		w.item = min(max(w.item+step, 0), len(w.items))
+	}
+}
+
+// next moves to the next choice, or adds an item to a list after the current
+// one.
+func (w *editorWidget) next() {
+	switch w.kind {
+	case widgetChoice:
+		w.step(1)
+	case widgetList:
+		w.item = min(w.item+1, len(w.items))
+		w.items = slices.Insert(w.items, w.item, "")
+	}
+}
+
+// ****** Rendering ***********************************************************
+
+// render draws the whole screen: a title, the visible rows scrolled to keep
+// the cursor in view, and the description of the current setting and the
+// keys in use at the bottom.
+func (e *settingsEditor) render() string {
+	e.c.lock.Lock()
+	defer e.c.lock.Unlock()
+
+	width := 0
+	for _, row := range e.rows {
+		width = max(width, 2*row.depth+2+utf8.RuneCountInString(e.label(row)))
+	}
+	var lines []string
+	first, last := 0, 0
+	for _, i := range e.visible() {
+		if i == e.cursor {
+			first = len(lines)
+		}
+		lines = append(lines, e.renderRow(e.rows[i], i == e.cursor, width)...)
+		if i == e.cursor {
+			last = len(lines) - 1
+		}
+	}
+	body := max(e.height-4, 1)
+	if last >= e.top+body {
+		e.top = last - body + 1
+	}
+	if first < e.top {
+		e.top = first
+	}
+	lines = lines[min(e.top, len(lines)):]
+	lines = lines[:min(body, len(lines))]
+
+	var sb strings.Builder
+	sb.WriteString(cursor.Hide + fmt.Sprintf(screen.SetPosition, 1, 1))
+	title := e.c.Metadata.configFile
+	if title == "" {
+		title = e.c.Metadata.appName
+	}
+	sb.WriteString(color.Bold + "Settings - " + title + color.Reset + screen.ClearToEnd + "\r\n\r\n")
+	for _, line := range lines {
+		sb.WriteString(line + screen.ClearToEnd + "\r\n")
+	}
+	sb.WriteString(screen.ClearDown + fmt.Sprintf(screen.SetPosition, max(e.height-1, 1), 1))
+	describe := []rune(e.describe())
+	describe = describe[:min(len(describe), max(e.width, 1))]
+	sb.WriteString(color.Grey + string(describe) + color.Reset + screen.ClearToEnd + "\r\n")
+	sb.WriteString(e.status() + screen.ClearToEnd)
+	return sb.String()
+}
+
+func (e *settingsEditor) label(row editorRow) string {
+	if row.s == nil {
+		return row.section[strings.LastIndex(row.section, ".")+1:]
+	}
+	return row.s.path[strings.LastIndex(row.s.path, ".")+1:]
+}
+
+// renderRow draws a row: a section heading, or a setting with its value, or
+// the widget editing it, its source and any problem with it.
+func (e *settingsEditor) renderRow(row editorRow, selected bool, width int) []string {
+	indent := strings.Repeat("  ", row.depth)
+	label := e.label(row)
+	if selected {
+		label = color.Reversed + label + color.Reset
+	}
+	if row.s == nil {
+		marker := "- "
+		if e.collapsed[row.section] {
+			marker = "+ "
+		}
+		return []string{indent + marker + color.Bold + label + color.Reset}
+	}
+
+	s := row.s
+	pad := strings.Repeat(" ", width-2*row.depth-utf8.RuneCountInString(e.label(row)))
+	line := indent + "  " + label + pad
+	source := s.source
+	if source == "" {
+		source = "-"
+	}
+	var extra []string
+	switch w := e.widget; {
+	case w != nil && w.s == s:
+		value, more := w.render()
+		line += value
+		extra = more
+		if _, err := s.parse(w.text()); err != nil {
+			line += "  " + color.Red + err.Error() + color.Reset
+		}
+	default:
+		if text, ok := e.edits[s.path]; ok {
+			if s.secret && text != "" {
+				text = redacted
+			}
+			line += color.Yellow + text + " *" + color.Reset + "  " + color.Grey + "edited" + color.Reset
+		} else {
+			line += s.display() + "  " + color.Grey + source + color.Reset
+		}
+		if err, ok := e.errors[s.path]; ok {
+			line += "  " + color.Red + err + color.Reset
+		}
+	}
+	for i := range extra {
+		extra[i] = indent + "    " + extra[i]
+	}
+	return append([]string{line}, extra...)
+}
+
+// render draws the widget in place of the value, with the items of a list on
+// the lines below.
+func (w *editorWidget) render() (string, []string) {
+	switch w.kind {
+	case widgetChoice:
+		choices := make([]string, len(w.choices))
+		for i, choice := range w.choices {
+			if i == w.choice {
+				choices[i] = color.Reversed + " " + choice + " " + color.Reset
+			} else {
+				choices[i] = color.Grey + " " + choice + " " + color.Reset
+			}
+		}
+		return strings.Join(choices, ""), nil
+	case widgetList:
+		lines := make([]string, 0, len(w.items)+1)
+		for i, item := range append(append([]string{}, w.items...), "") {
+			marker := "  "
+			if i == w.item {
+				marker = "> "
+				item += color.Underline + " " + color.Reset
+			} else if i == len(w.items) {
+				item = color.Grey + "+" + color.Reset
+			}
+			lines = append(lines, marker+item)
+		}
+		return fmt.Sprintf("%d items", len(w.items)), lines
+	}
+	text := string(w.input)
+	if w.s.secret {
+		text = strings.Repeat("*", len(w.input))
+	}
+	return color.Underline + text + " " + color.Reset, nil
+}
+
+// describe returns the description of the current setting with its default,
+// rules and the variable and flag that set it.
+func (e *settingsEditor) describe() string {
+	row := e.row()
+	if row.s == nil {
+		return row.section
+	}
+	parts := []string{row.s.path}
+	if row.s.desc != "" {
+		parts = append(parts, row.s.desc)
+	}
+	if row.s.def != "" {
+		parts = append(parts, "default "+row.s.def)
+	}
+	if row.s.validate != "" {
+		parts = append(parts, row.s.validate)
+	}
+	if row.s.env != "" {
+		parts = append(parts, "$"+row.s.env)
+	}
+	if row.s.cmd != "" {
+		parts = append(parts, row.s.cmd)
+	}
+	return strings.Join(parts, " - ")
+}
+
+// status returns the message of the last action, or the keys in use.
+func (e *settingsEditor) status() string {
+	if e.message != "" {
+		return e.message
+	}
+	switch {
+	case e.widget == nil:
+		help := "up/down move, enter edit, u undo, a apply, w apply and save, q quit"
+		if len(e.edits) > 0 {
+			help = fmt.Sprintf("%d unapplied changes - %s", len(e.edits), help)
+		}
+		return help
+	case e.widget.kind == widgetChoice:
+		return "left/right choose, enter accept, esc cancel"
+	case e.widget.kind == widgetList:
+		return "up/down select an item, tab add an item, enter accept, esc cancel"
+	}
+	return "enter accept, esc cancel"
+}
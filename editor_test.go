@@ -0,0 +1,226 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type editorConfig struct {
+	Name   string `yaml:"name" desc:"Service name" validate:"required"`
+	Server struct {
+		Port int    `yaml:"port" default:"8080" validate:"min=1024"`
+		Mode string `yaml:"mode" default:"dev" validate:"oneof=dev test prod"`
+		TLS  bool   `yaml:"tls"`
+	} `yaml:"server"`
+	Tags   []string       `yaml:"tags"`
+	Region string         `yaml:"region" readonly:""`
+	Token  string         `yaml:"token" secret:""`
+	Core   *Configuration `yaml:"core"`
+}
+
+var escapes = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// lastFrame returns the last screen drawn by the editor, without escapes.
+func lastFrame(out string) string {
+	frames := strings.Split(out, "\x1b[?25l")
+	return escapes.ReplaceAllString(frames[len(frames)-1], "")
+}
+
+func Test_EditSettings(t *testing.T) {
+	const (
+		up    = "\x1b[A"
+		down  = "\x1b[B"
+		right = "\x1b[C"
+		left  = "\x1b[D"
+	)
+	tests := map[string]struct {
+		script string
+		check  func(t *testing.T, config *editorConfig, file string, out string)
+	}{
+		"Apply": {
+			script: "jj\r\x159100\ra",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Equal(t, 9100, config.Server.Port)
+				assert.Contains(t, lastFrame(out), "port         9100  set")
+				assert.Contains(t, lastFrame(out), "applied 1 changes")
+				bs, _ := os.ReadFile(file)
+				assert.Equal(t, "name: demo\ntags: [a, b]\n", string(bs))
+			},
+		},
+		"Validated as typed": {
+			script: "jj\r\x1580\r\x1b",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Contains(t, escapes.ReplaceAllString(out, ""), "80   must be at least 1024")
+				assert.Equal(t, 8080, config.Server.Port)
+			},
+		},
+		"Choice saved": {
+			script: "jjj\r" + right + "\rw",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Equal(t, "test", config.Server.Mode)
+				bs, _ := os.ReadFile(file)
+				assert.Equal(t, "name: demo\ntags: [a, b]\nserver:\n  mode: test\n", string(bs))
+			},
+		},
+		"Toggle": {
+			script: down + down + down + down + "\ra",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.True(t, config.Server.TLS)
+			},
+		},
+		"List": {
+			script: "jjjjj\r" + down + "\x7f\x7fc" + up + "\tz\ra",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Equal(t, []string{"a", "z", "c"}, config.Tags)
+			},
+		},
+		"Undo": {
+			script: "jj\r\x159100\rua",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Equal(t, 8080, config.Server.Port)
+				assert.Contains(t, lastFrame(out), "nothing to apply")
+			},
+		},
+		"Unapplied": {
+			script: "jj\r\x159100\rq",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Equal(t, 8080, config.Server.Port)
+				assert.Contains(t, lastFrame(out), "1 unapplied changes, press q again to discard them")
+			},
+		},
+		"Collapsed": {
+			script: "j" + left,
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				frame := lastFrame(out)
+				assert.Contains(t, frame, "+ server")
+				assert.NotContains(t, frame, "port")
+				assert.Contains(t, frame, "tags")
+			},
+		},
+		"Rejected": {
+			script: "jj\r\x159100\rjjjj\r\x15eu\ra",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Equal(t, 8080, config.Server.Port)
+				assert.Equal(t, "", config.Region)
+				assert.Contains(t, lastFrame(out), "eu *  edited  read-only setting changed, restart to apply")
+			},
+		},
+		"Secret": {
+			script: "jjjjjjj\rhunter2\ra",
+			check: func(t *testing.T, config *editorConfig, file string, out string) {
+				assert.Equal(t, "hunter2", config.Token)
+				assert.NotContains(t, out, "hunter2")
+				assert.Contains(t, lastFrame(out), "token          ******  set")
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := writeManaged(t, "config.yaml", "name: demo\ntags: [a, b]\n")
+			out := &bytes.Buffer{}
+			config := &editorConfig{}
+			err := InitConfig(
+				context.Background(), config,
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(file),
+				ConfigurationOptionEnvironment(mapEnv{}),
+				ConfigurationOptionOutput(out),
+				typed(test.script+"qq"),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NoError(t, config.Core.EditSettings(context.Background()))
+			test.check(t, config, file, out.String())
+		})
+	}
+}
+
+func Test_EditSettingsScroll(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	config := &editorConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+	)
+	assert.NoError(t, err)
+
+	// Four rows fit on a screen of eight lines; moving down scrolls the rows
+	// above out of view.
+	e := config.Core.newSettingsEditor()
+	e.width, e.height = 80, 8
+	for i := 0; i < 6; i++ {
+		e.move(1)
+	}
+	frame := escapes.ReplaceAllString(e.render(), "")
+	assert.Contains(t, frame, "mode")
+	assert.Contains(t, frame, "region")
+	assert.NotContains(t, frame, "port")
+	assert.NotContains(t, frame, "token")
+
+	// Moving back up scrolls them in again.
+	for i := 0; i < 4; i++ {
+		e.move(-1)
+	}
+	frame = escapes.ReplaceAllString(e.render(), "")
+	assert.Contains(t, frame, "port")
+	assert.NotContains(t, frame, "region")
+}
+
+type normalizedConfig struct {
+	Name string         `yaml:"name"`
+	Port int            `yaml:"port" default:"8080"`
+	Core *Configuration `yaml:"core"`
+}
+
+// Normalize is deliberately not idempotent, so a second call would show.
+func (n *normalizedConfig) Normalize() {
+	n.Name += "!"
+}
+
+func Test_EditSettingsLifecycle(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	config := &normalizedConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "demo!", config.Name)
+	assert.NoError(t, config.Core.applyEdits(context.Background(), map[string]string{"port": "9100"}))
+	assert.Equal(t, 9100, config.Port)
+	assert.Equal(t, "demo!", config.Name)
+}
+
+func Test_TerminalSize(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	// Input that is not a terminal, whether a file or not, has the default
+	// size.
+	for _, input := range []io.Reader{r, strings.NewReader("")} {
+		width, height := terminalSize(input)()
+		assert.Equal(t, 80, width)
+		assert.Equal(t, 24, height)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+)
+
+// envValue is the value of an environment variable, or its absence.
+type envValue struct {
+	value string
+	set   bool
+}
+
+// ****** Environment *********************************************************
+
+// envSnapshot looks up every environment variable a setting is read from.
+func (c *Configuration) envSnapshot() map[string]envValue {
+	snapshot := make(map[string]envValue)
+	for _, s := range c.settings {
+		for _, name := range append([]string{s.env}, s.envAliases...) {
+			if name != "" {
+				value, ok := c.Metadata.environment.LookupEnv(name)
+				snapshot[name] = envValue{value: value, set: ok}
+			}
+		}
+	}
+	return snapshot
+}
+
+// checkForEnvChange reloads the configuration when an environment variable a
+// setting is read from has changed since it was last applied, so that the
+// monitors of the settings whose values changed are notified. Values given on
+// the command line still take precedence. The file is not read again; the
+// content last loaded or written is used.
+func (c *Configuration) checkForEnvChange(ctx context.Context) error {
+	// The comparison and the reload are one step, so a Setenv that finds the
+	// change already seen by the poller waits for its reload to publish it.
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	snapshot := c.envSnapshot()
+	c.lock.Lock()
+	changed := !maps.Equal(snapshot, c.envValues)
+	bs := c.fileContent
+	c.lock.Unlock()
+	if !changed {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.reloadContent(ctx, bs, auditEnv)
+}
+
+// mutableEnvironment is an Environment that can be changed, as the process
+// environment can.
+type mutableEnvironment interface {
+	Environment
+	Setenv(key string, value string) error
+	Unsetenv(key string) error
+}
+
+// Setenv sets an environment variable and, when a setting is read from it,
+// publishes the new value before returning, notifying its monitors. When the
+// new value cannot be applied the variable is restored and the error
+// returned. The environment must support being changed, as the process
+// environment does.
+func (c *Configuration) Setenv(key string, value string) error {
+	env, ok := c.Metadata.environment.(mutableEnvironment)
+	if !ok {
+		return &InvalidInitConfigError{Code: ErrEnvCoreConfig, Path: "$" + key, err: fmt.Errorf("environment cannot be changed")}
+	}
+	previous, set := env.LookupEnv(key)
+	if err := env.Setenv(key, value); err != nil {
+		return &InvalidInitConfigError{Code: ErrEnvCoreConfig, Path: "$" + key, err: err}
+	}
+	err := c.checkForEnvChange(context.Background())
+	if err == nil {
+		return nil
+	}
+	if set {
+		_ = env.Setenv(key, previous)
+	} else {
+		_ = env.Unsetenv(key)
+	}
+	return err
+}
+
+func (osEnvironment) Setenv(key string, value string) error {
+	return os.Setenv(key, value)
+}
+
+func (osEnvironment) Unsetenv(key string) error {
+	return os.Unsetenv(key)
+}
+
+// EnvInterval returns how often the watcher checks the environment for
+// changed variables, or 0 when it does not.
+func (m *configurationMetadata) EnvInterval() time.Duration {
+	return m.envInterval
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionEnvInterval sets how often the watcher checks the
+// environment for changed variables, every 5 seconds by default. An interval
+// of 0 stops the checks; Setenv still publishes changes.
+func ConfigurationOptionEnvInterval(interval time.Duration) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.envInterval = interval
+		return nil
+	}
+}
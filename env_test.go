@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fixedEnv map[string]string
+
+func (e fixedEnv) LookupEnv(key string) (string, bool) {
+	value, ok := e[key]
+	return value, ok
+}
+
+func Test_Setenv(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	config := &reloadConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+	)
+	assert.NoError(t, err)
+	var changes []interface{}
+	config.Core.AddNotifyOnChange("port", func(setting string, value interface{}) { changes = append(changes, value) })
+
+	// Monitors are notified before Setenv returns, and only on a change.
+	assert.NoError(t, config.Core.Setenv("CLIF_RELOAD_PORT", "9090"))
+	assert.Equal(t, 9090, config.Port)
+	assert.Equal(t, []interface{}{9090}, changes)
+	assert.NoError(t, config.Core.Setenv("CLIF_RELOAD_PORT", "9090"))
+	assert.NoError(t, config.Core.Setenv("UNRELATED", "x"))
+	assert.Equal(t, []interface{}{9090}, changes)
+
+	err = config.Core.Setenv("CLIF_RELOAD_PORT", "high")
+	if assert.Error(t, err) {
+		assert.Equal(t, "CLIF_RELOAD_PORT: expected int", err.Error())
+	}
+	assert.Equal(t, 9090, config.Port)
+}
+
+func Test_SetenvFailure(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	env := mapEnv{}
+	config := &reloadConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(env),
+	)
+	assert.NoError(t, err)
+
+	// A value that cannot be applied is taken back out of the environment,
+	// so later reloads still succeed.
+	assert.Error(t, config.Core.Setenv("CLIF_RELOAD_PORT", "high"))
+	_, ok := env["CLIF_RELOAD_PORT"]
+	assert.False(t, ok)
+	assert.NoError(t, config.Core.Reload(context.Background()))
+
+	assert.NoError(t, config.Core.Setenv("CLIF_RELOAD_PORT", "9090"))
+	assert.Error(t, config.Core.Setenv("CLIF_RELOAD_PORT", "high"))
+	assert.Equal(t, "9090", env["CLIF_RELOAD_PORT"])
+	assert.NoError(t, config.Core.Reload(context.Background()))
+	assert.Equal(t, 9090, config.Port)
+}
+
+func Test_SetenvKeepsFile(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	config := &reloadConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+	)
+	assert.NoError(t, err)
+
+	// A change to the environment is applied to the content last loaded;
+	// the file is left for the watcher to pick up.
+	assert.NoError(t, os.WriteFile(file, []byte("name: changed\n"), 0o600))
+	assert.NoError(t, config.Core.Setenv("CLIF_RELOAD_PORT", "9090"))
+	assert.Equal(t, 9090, config.Port)
+	assert.Equal(t, "demo", config.Name)
+}
+
+func Test_SetenvPrecedence(t *testing.T) {
+	config := &reloadConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(""),
+		ConfigurationOptionEnvironment(mapEnv{}),
+		ConfigurationOptionArgs([]string{"--set", "port=7000"}),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, config.Core.Setenv("CLIF_RELOAD_PORT", "9090"))
+	assert.Equal(t, 7000, config.Port)
+}
+
+func Test_SetenvUnsupported(t *testing.T) {
+	config := &reloadConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(""),
+		ConfigurationOptionEnvironment(fixedEnv{}),
+	)
+	assert.NoError(t, err)
+	err = config.Core.Setenv("CLIF_RELOAD_PORT", "9090")
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, ErrEnvCoreConfig)
+		assert.Equal(t, "$CLIF_RELOAD_PORT: environment cannot be changed", err.Error())
+	}
+	assert.Equal(t, 8080, config.Port)
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrorCode identifies a kind of error raised by the package. Codes are
+// errors themselves, so errors.Is(err, ErrValidateCoreConfig) reports whether
+// err, or any error it wraps or aggregates, has that code. A code also
+// matches the codes refining it: ErrUnmarshalCoreConfig matches
+// ErrUnmarshalLoggerData.
+type ErrorCode string
+
+var (
+	ErrHelpRequested       = fmt.Errorf("configuration help requested")
+	ErrCompletionRequested = fmt.Errorf("configuration completion requested")
+	ErrVersionRequested    = fmt.Errorf("configuration version requested")
+)
+
+const (
+	ErrMissingCoreConfig     ErrorCode = "CC01"
+	ErrAnonymousCoreConfig   ErrorCode = "CC02"
+	ErrUnmarshalCoreConfig   ErrorCode = "CC03"
+	ErrUnmarshalLoggerData   ErrorCode = "CC03LC01"
+	ErrUnmarshalConsoleData  ErrorCode = "CC03CC01"
+	ErrFileReadCoreConfig    ErrorCode = "CC04"
+	ErrNonExportedCoreConfig ErrorCode = "CC05"
+	ErrTypeCoreConfig        ErrorCode = "CC06"
+	ErrUnknownKeyCoreConfig  ErrorCode = "CC07"
+	ErrValidateCoreConfig    ErrorCode = "CC08"
+	ErrInterpolateCoreConfig ErrorCode = "CC09"
+	ErrFlagCoreConfig        ErrorCode = "CC10"
+	ErrCommandCoreConfig     ErrorCode = "CC11"
+	ErrReloadCoreConfig      ErrorCode = "CC12"
+	ErrAfterLoadCoreConfig   ErrorCode = "CC13"
+	ErrDeprecatedCoreConfig  ErrorCode = "CC14"
+	ErrArgumentCoreConfig    ErrorCode = "CC15"
+	ErrSetupCoreConfig       ErrorCode = "CC16"
+	ErrAuditCoreConfig       ErrorCode = "CC17"
+	ErrIntrospectCoreConfig  ErrorCode = "CC18"
+	ErrEnvCoreConfig         ErrorCode = "CC19"
+
+	ErrConsoleNoTerminal       ErrorCode = "CN01"
+	ErrConsoleInvalidRawMode   ErrorCode = "CN02"
+	ErrConsoleSizeUnavailable  ErrorCode = "CN03"
+	ErrConsoleUnmarshalType    ErrorCode = "CN04"
+	ErrConsoleSizeNonCompliant ErrorCode = "CN05"
+
+	ErrLoggerUnmarshalType ErrorCode = "LG01"
+)
+
+var errorText = map[ErrorCode]string{
+	ErrMissingCoreConfig:     "configuration error - core configuration not present",
+	ErrAnonymousCoreConfig:   "configuration error - core configuration is anonymous",
+	ErrUnmarshalCoreConfig:   "configuration error - unable to decode configuration",
+	ErrUnmarshalLoggerData:   "configuration error - invalid logger configuration",
+	ErrUnmarshalConsoleData:  "configuration error - invalid console configuration",
+	ErrFileReadCoreConfig:    "configuration error - unable to read configuration",
+	ErrNonExportedCoreConfig: "configuration error - core configuration is unexported",
+	ErrTypeCoreConfig:        "configuration error - value of the wrong type",
+	ErrUnknownKeyCoreConfig:  "configuration error - unknown key",
+	ErrValidateCoreConfig:    "configuration error - validation failed",
+	ErrInterpolateCoreConfig: "configuration error - unable to interpolate value",
+	ErrFlagCoreConfig:        "configuration error - invalid flag",
+	ErrCommandCoreConfig:     "configuration error - invalid command",
+	ErrReloadCoreConfig:      "configuration error - reload rejected",
+	ErrAfterLoadCoreConfig:   "configuration error - after load failed",
+	ErrDeprecatedCoreConfig:  "configuration error - deprecated setting",
+	ErrArgumentCoreConfig:    "configuration error - InitConfig needs a pointer to a struct",
+	ErrSetupCoreConfig:       "configuration error - setup not completed",
+	ErrAuditCoreConfig:       "configuration error - unable to write audit record",
+	ErrIntrospectCoreConfig:  "configuration error - unable to serve introspection",
+	ErrEnvCoreConfig:         "configuration error - unable to change environment",
+
+	ErrConsoleNoTerminal:       "console error - no terminal available",
+	ErrConsoleInvalidRawMode:   "console error - unable to enter raw mode",
+	ErrConsoleSizeUnavailable:  "console error - unable to obtain dimensions",
+	ErrConsoleUnmarshalType:    "console error - invalid type",
+	ErrConsoleSizeNonCompliant: "console warn - requested size not met",
+
+	ErrLoggerUnmarshalType: "logger error - invalid type",
+}
+
+// InvalidInitConfigError is the error raised while loading a configuration,
+// with the position in the file, or the setting, it concerns when known.
+type InvalidInitConfigError struct {
+	Code   ErrorCode
+	err    error
+	Type   reflect.Type
+	File   string
+	Line   int
+	Column int
+	Path   string
+}
+
+// ErrorList aggregates the errors found in a single pass, such as every
+// unknown key in a configuration file. errors.Is and errors.As look at each.
+type ErrorList []error
+
+type errorJSON struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Cause   string `json:"cause,omitempty"`
+}
+
+// ****** Codes ***************************************************************
+
+func (c ErrorCode) Error() string {
+	if text, ok := errorText[c]; ok {
+		return text
+	}
+	return string(c)
+}
+
+// Is reports whether c is target or refines it.
+func (c ErrorCode) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && code != "" && strings.HasPrefix(string(c), string(code))
+}
+
+func (c ErrorCode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(errorJSON{Code: string(c), Message: c.Error()})
+}
+
+// CodeOf returns the code of err, or of the first error with a code that it
+// wraps or aggregates, or "" when there is none.
+func CodeOf(err error) ErrorCode {
+	var e *InvalidInitConfigError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var code ErrorCode
+	if errors.As(err, &code) {
+		return code
+	}
+	return ""
+}
+
+// ****** Configuration errors ************************************************
+
+func (e InvalidInitConfigError) Error() string {
+	switch e.Code {
+	case ErrMissingCoreConfig:
+		return "configuration error - InitConfig(core configuration not present)"
+	case ErrAnonymousCoreConfig:
+		return "configuration error - InitConfig(core configuration is anonymous)"
+	case ErrNonExportedCoreConfig:
+		return "configuration error - InitConfig(core configuration is unexported)"
+	case ErrTypeCoreConfig, ErrUnknownKeyCoreConfig, ErrValidateCoreConfig, ErrInterpolateCoreConfig,
+		ErrFlagCoreConfig, ErrCommandCoreConfig, ErrAfterLoadCoreConfig, ErrDeprecatedCoreConfig,
+		ErrSetupCoreConfig, ErrAuditCoreConfig, ErrIntrospectCoreConfig, ErrEnvCoreConfig:
+		return e.location() + e.err.Error()
+	case ErrReloadCoreConfig:
+		return e.location() + "reload rejected: " + e.err.Error()
+	case ErrUnmarshalCoreConfig, ErrUnmarshalLoggerData, ErrUnmarshalConsoleData,
+		ErrFileReadCoreConfig:
+		if e.Line > 0 {
+			return e.location() + e.err.Error()
+		}
+		return fmt.Sprintf("configuration error - %v", e.err)
+	default:
+		if e.Type == nil {
+			return "configuration error - InitConfig(nil)"
+		}
+
+		if e.Type == configurationType {
+			return "configuration error - InitConfig(non-pointer of embedded " + e.Type.String() + ")"
+		} else if e.Type.Kind() != reflect.Pointer {
+			return "configuration error - InitConfig(non-pointer " + e.Type.String() + ")"
+		}
+
+		return "configuration error - InitConfig(nil " + e.Type.String() + ")"
+	}
+}
+
+// Unwrap returns the underlying cause, such as the error returned by a
+// Validate method or by the file system.
+func (e InvalidInitConfigError) Unwrap() error {
+	return e.err
+}
+
+// Is matches the error's code, so errors.Is(err, ErrUnknownKeyCoreConfig)
+// finds an unknown key.
+func (e InvalidInitConfigError) Is(target error) bool {
+	return e.Code.Is(target)
+}
+
+// MarshalJSON renders the error as an object with its code, message and
+// position, for structured logs.
+func (e InvalidInitConfigError) MarshalJSON() ([]byte, error) {
+	v := errorJSON{Code: string(e.Code), Message: e.Error(), File: e.File, Line: e.Line, Column: e.Column, Path: e.Path}
+	if e.err != nil {
+		v.Cause = e.err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// location renders the position of the error as file:line:column: path:,
+// omitting the parts that are not known.
+func (e InvalidInitConfigError) location() string {
+	var sb strings.Builder
+	if e.File != "" {
+		sb.WriteString(e.File)
+		if e.Line > 0 {
+			sb.WriteString(fmt.Sprintf(":%d:%d", e.Line, e.Column))
+		}
+		sb.WriteString(": ")
+	}
+	if e.Path != "" {
+		sb.WriteString(e.Path + ": ")
+	}
+	return sb.String()
+}
+
+// ****** Error lists *********************************************************
+
+// joinErrors returns nil for no errors, the error itself for one, and an
+// ErrorList for more.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return ErrorList(errs)
+}
+
+// appendError adds err, or the errors of an ErrorList, to errs.
+func appendError(errs []error, err error) []error {
+	if list, ok := err.(ErrorList); ok {
+		return append(errs, list...)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Error lists the errors one per line.
+func (l ErrorList) Error() string {
+	lines := make([]string, len(l))
+	for i, err := range l {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l ErrorList) Unwrap() []error {
+	return l
+}
+
+// MarshalJSON renders the list as an array of errors.
+func (l ErrorList) MarshalJSON() ([]byte, error) {
+	items := make([]json.RawMessage, len(l))
+	for i, err := range l {
+		bs, err := MarshalError(err)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = bs
+	}
+	return json.Marshal(items)
+}
+
+// MarshalError renders any error as JSON: the package's errors with their
+// codes and positions, an ErrorList as an array, and other errors as an
+// object with the message and the code of any error they wrap.
+func MarshalError(err error) ([]byte, error) {
+	if m, ok := err.(json.Marshaler); ok {
+		return m.MarshalJSON()
+	}
+	v := errorJSON{Code: string(CodeOf(err)), Message: err.Error()}
+	if cause := errors.Unwrap(err); cause != nil {
+		v.Cause = cause.Error()
+	}
+	return json.Marshal(v)
+}
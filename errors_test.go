@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ErrorList(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\nport: high\nhost: x\nextra: y\n")
+	err := InitConfig(context.Background(), &managedConfig{}, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.Equal(t, file+":2:7: port: expected int\n"+
+		file+":3:1: host: unknown key\n"+
+		file+":4:1: extra: unknown key", err.Error())
+	assert.ErrorIs(t, err, ErrTypeCoreConfig)
+	assert.ErrorIs(t, err, ErrUnknownKeyCoreConfig)
+	assert.NotErrorIs(t, err, ErrValidateCoreConfig)
+	assert.Equal(t, ErrTypeCoreConfig, CodeOf(err))
+
+	var e *InvalidInitConfigError
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, "port", e.Path)
+		assert.Equal(t, 2, e.Line)
+	}
+
+	bs, err := MarshalError(err)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"code": "CC06", "message": "`+file+`:2:7: port: expected int", "file": "`+file+`", "line": 2, "column": 7, "path": "port", "cause": "expected int"},
+		{"code": "CC07", "message": "`+file+`:3:1: host: unknown key", "file": "`+file+`", "line": 3, "column": 1, "path": "host", "cause": "unknown key"},
+		{"code": "CC07", "message": "`+file+`:4:1: extra: unknown key", "file": "`+file+`", "line": 4, "column": 1, "path": "extra", "cause": "unknown key"}
+	]`, string(bs))
+}
+
+func Test_ErrorValidateList(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "port: 80\n")
+	err := InitConfig(context.Background(), &managedConfig{}, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if assert.Error(t, err) {
+		assert.Equal(t, "name: value is required\n"+file+":1:7: port: must be at least 1024", err.Error())
+		assert.ErrorIs(t, err, ErrValidateCoreConfig)
+		assert.Len(t, err.(ErrorList), 2)
+	}
+}
+
+func Test_ErrorUnwrap(t *testing.T) {
+	err := InitConfig(context.Background(), &managedConfig{}, configurationOptionNoWatch(), ConfigurationOptionConfigFile("absent.yaml"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorIs(t, err, ErrFileReadCoreConfig)
+
+	err = InitConfig(context.Background(), managedConfig{})
+	assert.ErrorIs(t, err, ErrArgumentCoreConfig)
+	assert.Equal(t, "configuration error - InitConfig(non-pointer clif.managedConfig)", err.Error())
+
+	c := &Configuration{}
+	err = c.UnmarshalJSON([]byte(`{"console": 1}`))
+	var e *InvalidInitConfigError
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, ErrUnmarshalConsoleData, e.Code)
+	}
+	assert.ErrorIs(t, err, ErrUnmarshalCoreConfig)
+}
+
+func Test_ErrorCode(t *testing.T) {
+	assert.ErrorIs(t, ErrUnmarshalLoggerData, ErrUnmarshalCoreConfig)
+	assert.NotErrorIs(t, ErrUnmarshalCoreConfig, ErrUnmarshalLoggerData)
+	assert.NotErrorIs(t, ErrTypeCoreConfig, ErrorCode(""))
+
+	err := fmt.Errorf("%w: device busy", ErrConsoleInvalidRawMode)
+	assert.ErrorIs(t, err, ErrConsoleInvalidRawMode)
+	assert.Equal(t, ErrConsoleInvalidRawMode, CodeOf(err))
+	assert.Equal(t, "console error - unable to enter raw mode: device busy", err.Error())
+	assert.Equal(t, ErrorCode(""), CodeOf(errors.New("plain")))
+
+	bs, err := json.Marshal(ErrConsoleNoTerminal)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"code": "CN01", "message": "console error - no terminal available"}`, string(bs))
+	bs, err = MarshalError(fmt.Errorf("%w: device busy", ErrConsoleInvalidRawMode))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"code": "CN02", "message": "console error - unable to enter raw mode: device busy", "cause": "console error - unable to enter raw mode"}`, string(bs))
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jfigge/clif/constants/color"
+	"golang.org/x/term"
+)
+
+// DefaultHelpTemplate renders the usage text. It is executed with a HelpData
+// and may be replaced through ConfigurationOptionHelpTemplate.
+const DefaultHelpTemplate = `{{if .Description}}{{wrap .Description 0 $.Width}}
+
+{{end}}{{style "heading" "Usage:"}}
+  {{.AppName}}{{if .Flags}} [flags]{{end}}{{if .Commands}} <command>{{end}}{{if .Usage}} {{.Usage}}{{end}}
+{{- if .Commands}}
+
+{{style "heading" "Commands:"}}
+{{- range .Commands}}
+  {{style "flag" (pad .Name $.CommandWidth)}}  {{wrap .Description (add $.CommandWidth 4) $.Width}}
+{{- end}}
+{{- end}}
+{{- range .Groups}}
+
+{{style "heading" .Title}}
+{{- range .Flags}}
+  {{style "flag" (pad .Name $.FlagWidth)}}  {{wrap .Text (add $.FlagWidth 4) $.Width}}
+{{- end}}
+{{- end}}
+`
+
+type HelpData struct {
+	AppName      string
+	Description  string
+	Usage        string
+	Commands     []*HelpCommand
+	CommandWidth int
+	Groups       []*HelpGroup
+	Flags        []*HelpFlag
+	FlagWidth    int
+	Width        int
+	Color        bool
+}
+type HelpCommand struct {
+	Name        string
+	Aliases     []string
+	Description string
+}
+type HelpGroup struct {
+	Name  string
+	Title string
+	Flags []*HelpFlag
+}
+type HelpFlag struct {
+	Name        string
+	Path        string
+	Flag        string
+	Env         string
+	Default     string
+	Type        string
+	Description string
+	Enum        []string
+	Text        string
+}
+
+// ****** Help ****************************************************************
+
+// Usage writes the help text for the configuration to w.
+func (c *Configuration) Usage(w io.Writer) error {
+	data := c.helpData(w)
+	tmpl, err := template.New("help").Funcs(helpFuncs(data.Color)).Parse(c.Metadata.helpTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
+
+func (c *Configuration) helpData(w io.Writer) *HelpData {
+	data := &HelpData{
+		AppName: c.Metadata.appName,
+		Usage:   c.Metadata.usage,
+		Width:   80,
+	}
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		data.Color = true
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil {
+			data.Width = width
+		}
+	} else if columns, ok := c.Metadata.environment.LookupEnv("COLUMNS"); ok {
+		if width, err := strconv.Atoi(columns); err == nil && width > 0 {
+			data.Width = width
+		}
+	}
+	if cmd := c.command; cmd != nil {
+		data.AppName = cmd.CommandPath()
+		data.Description = cmd.Description
+		if cmd.Usage != "" {
+			data.Usage = cmd.Usage
+		}
+		for _, sub := range cmd.commands {
+			if sub.Hidden {
+				continue
+			}
+			command := &HelpCommand{Name: sub.Name, Aliases: sub.Aliases, Description: sub.Description}
+			if len(sub.Aliases) > 0 {
+				command.Name += ", " + strings.Join(sub.Aliases, ", ")
+			}
+			if len(command.Name) > data.CommandWidth {
+				data.CommandWidth = len(command.Name)
+			}
+			data.Commands = append(data.Commands, command)
+		}
+	}
+
+	groups := make(map[string]*HelpGroup)
+	for _, s := range c.settings {
+		if (s.cmd == "" && s.env == "") || !c.inScope(s) {
+			continue
+		}
+		flag := &HelpFlag{
+			Path:        s.path,
+			Flag:        s.cmd,
+			Env:         s.env,
+			Default:     s.def,
+			Type:        typeName(s.field.Type),
+			Description: s.desc,
+			Enum:        enumValues(s.validate),
+		}
+		flag.Name = flag.Flag
+		if flag.Name == "" {
+			flag.Name = "$" + flag.Env
+		}
+		if flag.Type != "bool" {
+			flag.Name += " " + flag.Type
+		}
+		flag.Text = helpText(flag)
+		if len(flag.Name) > data.FlagWidth {
+			data.FlagWidth = len(flag.Name)
+		}
+
+		name, title := "", "Options:"
+		if s.command == c.command && s.command != nil {
+			name, title = s.command.bindingPrefix(), "Flags:"
+		} else if s.command != nil {
+			name, title = "inherited", "Inherited flags:"
+		} else if index := strings.LastIndex(s.path, "."); index != -1 {
+			name = s.path[:index]
+			title = name + " options:"
+		}
+		group, ok := groups[name]
+		if !ok {
+			group = &HelpGroup{Name: name, Title: title}
+			groups[name] = group
+			data.Groups = append(data.Groups, group)
+		}
+		group.Flags = append(group.Flags, flag)
+		data.Flags = append(data.Flags, flag)
+	}
+
+	// A command's own flags lead, followed by those it inherits.
+	rank := func(group *HelpGroup) int {
+		switch {
+		case c.command != nil && group.Name == c.command.bindingPrefix():
+			return 0
+		case group.Name == "inherited":
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(data.Groups, func(i, j int) bool {
+		return rank(data.Groups[i]) < rank(data.Groups[j])
+	})
+	return data
+}
+
+// inScope reports whether a setting applies to the selected command.
+func (c *Configuration) inScope(s *setting) bool {
+	return s.command == nil || s.command == c.command || s.persistent
+}
+
+func helpText(flag *HelpFlag) string {
+	var details []string
+	if len(flag.Enum) > 0 {
+		details = append(details, "one of: "+strings.Join(flag.Enum, ", "))
+	}
+	if flag.Default != "" {
+		details = append(details, "default: "+flag.Default)
+	}
+	if flag.Env != "" && flag.Flag != "" {
+		details = append(details, "env: "+flag.Env)
+	}
+	text := flag.Description
+	if len(details) > 0 {
+		if text != "" {
+			text += " "
+		}
+		text += "(" + strings.Join(details, "; ") + ")"
+	}
+	return text
+}
+
+func helpFuncs(colorize bool) template.FuncMap {
+	styles := map[string]string{
+		"heading": color.Bold + color.BrightWhite,
+		"flag":    color.Cyan,
+	}
+	return template.FuncMap{
+		"style": func(name string, text string) string {
+			if !colorize || styles[name] == "" {
+				return text
+			}
+			return styles[name] + text + color.Reset
+		},
+		"pad": func(text string, width int) string {
+			return fmt.Sprintf("%-*s", width, text)
+		},
+		"add": func(a, b int) int {
+			return a + b
+		},
+		"wrap": wrapText,
+	}
+}
+
+// wrapText breaks text into lines that fit between indent and width. The
+// first line is assumed to already be positioned at indent.
+func wrapText(text string, indent int, width int) string {
+	available := width - indent
+	if available < 20 {
+		available = 20
+	}
+	var sb strings.Builder
+	line := 0
+	for _, word := range strings.Fields(text) {
+		if line > 0 && line+1+len(word) > available {
+			sb.WriteString("\n" + strings.Repeat(" ", indent))
+			line = 0
+		} else if line > 0 {
+			sb.WriteString(" ")
+			line++
+		}
+		sb.WriteString(word)
+		line += len(word)
+	}
+	return sb.String()
+}
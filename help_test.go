@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type helpServer struct {
+	Address string         `yaml:"address" cmd:"--server-address" env:"${APPNAME}_ADDRESS" default:"localhost:8080" desc:"Address the server listens on"`
+	Mode    string         `yaml:"mode" cmd:"--server-mode" validate:"oneof=dev prod" desc:"Deployment mode"`
+	Verbose bool           `yaml:"verbose" cmd:"--verbose" desc:"Log every request, including the health checks issued by the load balancer every few seconds"`
+	Token   string         `yaml:"token" env:"${APPNAME}_TOKEN" desc:"API token"`
+	Ignored string         `yaml:"ignored"`
+	Core    *Configuration `yaml:"core"`
+}
+
+func Test_Help(t *testing.T) {
+	t.Setenv("COLUMNS", "80")
+	out := &bytes.Buffer{}
+	err := InitConfig(
+		context.Background(), &helpServer{},
+		configurationOptionNoWatch(),
+		ConfigurationOptionAppName("/usr/bin/demo-app"),
+		ConfigurationOptionArgs([]string{"--help"}),
+		ConfigurationOptionUsage("<file>..."),
+		ConfigurationOptionOutput(out),
+	)
+	assert.ErrorIs(t, err, ErrHelpRequested)
+	assert.Equal(t, `Usage:
+  /usr/bin/demo-app [flags] <file>...
+
+Options:
+  --server-address string  Address the server listens on (default:
+                           localhost:8080; env: DEMO_APP_ADDRESS)
+  --server-mode string     Deployment mode (one of: dev, prod)
+  --verbose                Log every request, including the health checks issued
+                           by the load balancer every few seconds
+  $DEMO_APP_TOKEN string   API token
+
+core.logger options:
+  --logger-level string    Minimum level of messages to log (one of: trace,
+                           debug, info, warn, error; default: info; env:
+                           DEMO_APP_LOGGER_LEVEL)
+  --logger-colorized       Colorize log output (env: DEMO_APP_LOGGER_COLORIZED)
+
+core.console options:
+  --console-width int      Minimum console width in columns
+  --console-height int     Minimum console height in rows
+`, out.String())
+}
+
+func Test_HelpTemplate(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := InitConfig(
+		context.Background(), &helpServer{},
+		configurationOptionNoWatch(),
+		ConfigurationOptionAppName("demo"),
+		ConfigurationOptionArgs([]string{"-h"}),
+		ConfigurationOptionOutput(out),
+		ConfigurationOptionHelpTemplate(`{{range .Flags}}{{if .Env}}{{.Env}}={{.Default}}{{"\n"}}{{end}}{{end}}`),
+	)
+	assert.ErrorIs(t, err, ErrHelpRequested)
+	assert.Equal(t, "DEMO_ADDRESS=localhost:8080\nDEMO_TOKEN=\nDEMO_LOGGER_LEVEL=info\nDEMO_LOGGER_COLORIZED=\n", out.String())
+}
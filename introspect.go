@@ -0,0 +1,301 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	introspectUnix    = "unix:"
+	introspectSocket  = "introspect.sock"
+	introspectTimeout = 5 * time.Second
+)
+
+// reloadResult is the outcome of the last reload, as served by the
+// introspection server.
+type reloadResult struct {
+	Time    time.Time       `json:"time"`
+	Trigger string          `json:"trigger"`
+	Changes Diff            `json:"changes"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+type notificationsJSON struct {
+	Settings  map[string]int `json:"settings"`
+	OnReload  int            `json:"onReload"`
+	OnRestart int            `json:"onRestart"`
+	Files     []string       `json:"files"`
+}
+
+type introspectionJSON struct {
+	Config        map[string]interface{} `json:"config"`
+	Sources       map[string]string      `json:"sources"`
+	Notifications notificationsJSON      `json:"notifications"`
+	LastReload    *reloadResult          `json:"lastReload"`
+}
+
+// ****** Introspection *******************************************************
+
+// recordReload keeps the outcome of a reload for the introspection server.
+func (c *configurationData) recordReload(trigger string, diff Diff, err error) {
+	result := &reloadResult{Time: time.Now(), Trigger: trigger, Changes: append(Diff{}, diff...)}
+	if err != nil {
+		result.Error, _ = MarshalError(err)
+	}
+	c.lock.Lock()
+	c.lastReload = result
+	c.lock.Unlock()
+}
+
+// startIntrospection starts the introspection server, which stops when ctx
+// is done. Both its goroutines are counted by the ConfigurationOptionWaitGroup
+// WaitGroup.
+func (c *Configuration) startIntrospection(ctx context.Context) error {
+	network, address, err := c.introspectionAddress()
+	if err != nil {
+		return &InvalidInitConfigError{Code: ErrIntrospectCoreConfig, Path: c.Metadata.introspect, err: err}
+	}
+	if network == "unix" {
+		// A socket left behind by a process that did not stop cleanly would
+		// prevent listening.
+		if info, err := os.Lstat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(address)
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return &InvalidInitConfigError{Code: ErrIntrospectCoreConfig, Path: c.Metadata.introspect, err: err}
+	}
+	if network == "unix" {
+		if err = os.Chmod(address, 0o600); err != nil {
+			_ = listener.Close()
+			return &InvalidInitConfigError{Code: ErrIntrospectCoreConfig, Path: c.Metadata.introspect, err: err}
+		}
+	}
+	c.lock.Lock()
+	c.introspected = listener.Addr().String()
+	c.lock.Unlock()
+
+	server := &http.Server{
+		Handler:           c.introspectionHandler(),
+		ReadHeaderTimeout: introspectTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	if c.Metadata.wg != nil {
+		c.Metadata.wg.Add(2)
+	}
+	go func() {
+		if c.Metadata.wg != nil {
+			defer c.Metadata.wg.Done()
+		}
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			c.notifyError(&InvalidInitConfigError{Code: ErrIntrospectCoreConfig, Path: c.Metadata.introspect, err: err})
+		}
+	}()
+	go func() {
+		if c.Metadata.wg != nil {
+			defer c.Metadata.wg.Done()
+		}
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), introspectTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	return nil
+}
+
+// introspectionAddress resolves the address to listen on: a unix socket,
+// by default in the runtime directory, or a port on the loopback interface.
+func (c *Configuration) introspectionAddress() (string, string, error) {
+	address := c.Metadata.introspect
+	if strings.HasPrefix(address, introspectUnix) {
+		path := strings.TrimPrefix(address, introspectUnix)
+		if path == "" {
+			dir, err := c.Metadata.RuntimeDir()
+			if err != nil {
+				return "", "", err
+			}
+			path = filepath.Join(dir, introspectSocket)
+		}
+		return "unix", path, nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", err
+	}
+	// An empty host would listen on every interface.
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", "", fmt.Errorf("not a loopback address")
+	}
+	return "tcp", address, nil
+}
+
+// IntrospectionAddr returns the address the introspection server listens on,
+// the path of its socket or its host and port, or "" when it is not running.
+func (c *configurationData) IntrospectionAddr() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.introspected
+}
+
+// introspectionHandler serves the state of the configuration as JSON:
+//
+//	GET  /               everything below
+//	GET  /config         the effective configuration, secrets redacted
+//	GET  /sources        where each setting's value came from
+//	GET  /notifications  the monitors, hooks and files registered
+//	GET  /reload         the outcome of the last reload
+//	POST /reload         reloads the configuration and returns the outcome
+func (c *Configuration) introspectionHandler() http.Handler {
+	mux := http.NewServeMux()
+	guarded := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A web page the user visits can reach a loopback port: through DNS
+		// rebinding, which leaves its own name in Host, or with a cross-site
+		// request, which carries an Origin.
+		if !c.introspectionHost(r.Host) {
+			serveJSON(w, http.StatusForbidden, map[string]string{"error": "host not allowed"})
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Header.Get("Origin") != "" {
+			serveJSON(w, http.StatusForbidden, map[string]string{"error": "cross-origin request"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	get := func(f func() interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Allow", "GET, HEAD")
+				serveJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+				return
+			}
+			serveJSON(w, http.StatusOK, f())
+		}
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			serveJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		get(func() interface{} { return c.introspection() })(w, r)
+	})
+	mux.HandleFunc("/config", get(func() interface{} { return c.introspection().Config }))
+	mux.HandleFunc("/sources", get(func() interface{} { return c.introspection().Sources }))
+	mux.HandleFunc("/notifications", get(func() interface{} { return c.introspection().Notifications }))
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			get(func() interface{} { return c.introspection().LastReload })(w, r)
+			return
+		}
+		status := http.StatusOK
+		if err := c.Reload(r.Context()); err != nil {
+			status = http.StatusUnprocessableEntity
+		}
+		c.lock.Lock()
+		result := c.lastReload
+		c.lock.Unlock()
+		serveJSON(w, status, result)
+	})
+	return guarded
+}
+
+// introspectionHost reports whether a request's Host header names the
+// introspection server: a loopback address or localhost, with the port
+// listened on. Requests over a unix socket are not checked.
+func (c *Configuration) introspectionHost(host string) bool {
+	if strings.HasPrefix(c.Metadata.introspect, introspectUnix) {
+		return true
+	}
+	c.lock.Lock()
+	addr := c.introspected
+	c.lock.Unlock()
+	_, port, _ := net.SplitHostPort(addr)
+	name, requestPort, err := net.SplitHostPort(host)
+	if err != nil || requestPort != port {
+		return false
+	}
+	ip := net.ParseIP(name)
+	return strings.EqualFold(name, "localhost") || (ip != nil && ip.IsLoopback())
+}
+
+// introspection gathers the state served by the introspection server.
+func (c *Configuration) introspection() introspectionJSON {
+	files := c.watchedFiles()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := introspectionJSON{
+		Config:  make(map[string]interface{}),
+		Sources: make(map[string]string),
+		Notifications: notificationsJSON{
+			Settings:  make(map[string]int),
+			OnReload:  len(c.reloadFuncs),
+			OnRestart: len(c.restartFuncs),
+			Files:     make([]string, 0, len(files)),
+		},
+		LastReload: c.lastReload,
+	}
+	for _, s := range c.settings {
+		var value interface{} = s.value.Interface()
+		if s.secret && !s.value.IsZero() {
+			value = redacted
+		}
+		node := state.Config
+		keys := strings.Split(s.path, ".")
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[key] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = value
+		state.Sources[s.path] = s.source
+	}
+	for path, notifyFuncs := range c.notifyFuncs {
+		state.Notifications.Settings[path] = len(notifyFuncs)
+	}
+	for _, f := range files {
+		state.Notifications.Files = append(state.Notifications.Files, f.path)
+	}
+	return state
+}
+
+func serveJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionIntrospection serves the effective configuration, with
+// secrets redacted, where each value came from, the registered monitors and
+// hooks and the outcome of the last reload as JSON, and reloads the
+// configuration on a POST to /reload. The address is "unix:" and the path of
+// a socket, "unix:" alone for a socket in the runtime directory, or a port on
+// the loopback interface such as "localhost:7070"; a port without a host,
+// which would listen on every interface, is rejected. Over TCP, requests must
+// name the server in their Host header and a POST must not carry an Origin,
+// so that web pages cannot reach it. The server stops when the context passed
+// to InitConfig is done.
+func ConfigurationOptionIntrospection(address string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.introspect = address
+		return nil
+	}
+}
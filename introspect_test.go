@@ -0,0 +1,206 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// introspect starts a configuration with an introspection server on address
+// and returns a client for it.
+func introspect(t *testing.T, ctx context.Context, wg *sync.WaitGroup, address string) (*managedConfig, string, *http.Client, string) {
+	file := writeManaged(t, "config.yaml", managedYAML)
+	config := &managedConfig{}
+	err := InitConfig(
+		ctx, config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+		ConfigurationOptionWaitGroup(wg),
+		ConfigurationOptionIntrospection(address),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := config.Core.IntrospectionAddr()
+	if !strings.HasPrefix(address, introspectUnix) {
+		return config, file, http.DefaultClient, "http://" + addr
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		},
+	}}
+	return config, file, client, "http://introspect"
+}
+
+func request(t *testing.T, client *http.Client, method string, url string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	bs, _ := io.ReadAll(resp.Body)
+	var body map[string]interface{}
+	if err = json.Unmarshal(bs, &body); err != nil {
+		t.Fatalf("%s: %s", err, bs)
+	}
+	return resp.StatusCode, body
+}
+
+func Test_Introspection(t *testing.T) {
+	for name, address := range map[string]string{
+		"Loopback": "127.0.0.1:0",
+		"Socket":   introspectUnix + filepath.Join(t.TempDir(), "clif.sock"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := &sync.WaitGroup{}
+			config, file, client, url := introspect(t, ctx, wg, address)
+			config.Core.AddNotifyOnChange("port", func(setting string, value interface{}) {})
+			config.Core.AddNotifyOnChange("port", func(setting string, value interface{}) {})
+			OnReload(config.Core, func(old *managedConfig, new *managedConfig) error { return nil })
+
+			status, body := request(t, client, http.MethodGet, url+"/")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, map[string]interface{}{"name": "demo", "port": float64(9000), "password": "******"},
+				withoutCore(body["config"]))
+			sources := body["sources"].(map[string]interface{})
+			assert.Equal(t, "file", sources["port"])
+			assert.Equal(t, map[string]interface{}{"port": float64(2)}, body["notifications"].(map[string]interface{})["settings"])
+			assert.Equal(t, float64(1), body["notifications"].(map[string]interface{})["onReload"])
+			assert.Nil(t, body["lastReload"])
+
+			// A reload through the server publishes the change and reports it.
+			assert.NoError(t, os.WriteFile(file, []byte("name: demo\nport: 9100\n"), 0o600))
+			status, body = request(t, client, http.MethodPost, url+"/reload")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "reload", body["trigger"])
+			assert.Equal(t, []interface{}{
+				map[string]interface{}{"path": "port", "kind": "changed", "old": float64(9000), "new": float64(9100)},
+				map[string]interface{}{"path": "password", "kind": "changed", "old": "******", "new": ""},
+			}, body["changes"])
+			assert.Equal(t, 9100, config.Port)
+
+			// A failed reload is reported, and the last result kept.
+			assert.NoError(t, os.WriteFile(file, []byte("name: demo\nport: 80\n"), 0o600))
+			status, body = request(t, client, http.MethodPost, url+"/reload")
+			assert.Equal(t, http.StatusUnprocessableEntity, status)
+			assert.Equal(t, "CC08", body["error"].(map[string]interface{})["code"])
+			status, body = request(t, client, http.MethodGet, url+"/reload")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "port", body["error"].(map[string]interface{})["path"])
+			assert.Equal(t, "must be at least 1024", body["error"].(map[string]interface{})["cause"])
+
+			status, body = request(t, client, http.MethodGet, url+"/config")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, float64(9100), body["port"])
+			status, _ = request(t, client, http.MethodDelete, url+"/config")
+			assert.Equal(t, http.StatusMethodNotAllowed, status)
+			status, _ = request(t, client, http.MethodGet, url+"/missing")
+			assert.Equal(t, http.StatusNotFound, status)
+
+			// The server stops with the context.
+			cancel()
+			wg.Wait()
+			_, err := client.Get(url + "/")
+			assert.Error(t, err)
+			if strings.HasPrefix(address, introspectUnix) {
+				assert.NoFileExists(t, strings.TrimPrefix(address, introspectUnix))
+			}
+		})
+	}
+}
+
+// withoutCore drops the settings of the core configuration.
+func withoutCore(config interface{}) map[string]interface{} {
+	m := config.(map[string]interface{})
+	delete(m, "core")
+	return m
+}
+
+func Test_IntrospectionAddress(t *testing.T) {
+	for address, expect := range map[string]string{
+		"0.0.0.0:0":      "0.0.0.0:0: not a loopback address",
+		"example.com:80": "example.com:80: not a loopback address",
+		"localhost":      "localhost: address localhost: missing port in address",
+		":7070":          ":7070: not a loopback address",
+	} {
+		t.Run(address, func(t *testing.T) {
+			file := writeManaged(t, "config.yaml", managedYAML)
+			err := InitConfig(
+				context.Background(), &managedConfig{},
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(file),
+				ConfigurationOptionIntrospection(address),
+			)
+			if assert.Error(t, err) {
+				assert.ErrorIs(t, err, ErrIntrospectCoreConfig)
+				assert.Equal(t, expect, err.Error())
+			}
+		})
+	}
+}
+
+func Test_IntrospectionForeignRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	config, _, client, url := introspect(t, ctx, wg, "127.0.0.1:0")
+	_, port, _ := net.SplitHostPort(config.Core.IntrospectionAddr())
+
+	tests := map[string]struct {
+		method string
+		host   string
+		origin string
+		status int
+	}{
+		"Loopback":        {method: http.MethodGet, status: http.StatusOK},
+		"Localhost":       {method: http.MethodGet, host: "localhost:" + port, status: http.StatusOK},
+		"Rebound":         {method: http.MethodGet, host: "attacker.example:" + port, status: http.StatusForbidden},
+		"Other port":      {method: http.MethodGet, host: "127.0.0.1:1", status: http.StatusForbidden},
+		"Cross-site POST": {method: http.MethodPost, origin: "https://attacker.example", status: http.StatusForbidden},
+		"Cross-site GET":  {method: http.MethodGet, origin: "https://attacker.example", status: http.StatusOK},
+		"Local POST":      {method: http.MethodPost, status: http.StatusOK},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, url+"/reload", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.host != "" {
+				req.Host = test.host
+			}
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			assert.Equal(t, test.status, resp.StatusCode)
+		})
+	}
+}
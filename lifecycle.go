@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"reflect"
+	"unsafe"
+)
+
+// Configuration structs, and the structs nested in them, can take part in
+// loading by implementing any of the interfaces below. Once the default
+// tags, configuration file, environment and command line have been merged
+// they are called in this order, each for every struct, nested structs
+// before the struct holding them:
+//
+//  1. SetDefaults, to fill in what the sources left unset
+//  2. Normalize, to clean up values, e.g. trimming or lower-casing
+//  3. the validate tags are checked
+//  4. Validate, for checks involving more than one field
+//  5. AfterLoad, to act on the loaded configuration
+//
+// AfterLoad is only called for the live configuration when it is first
+// loaded, and on each reload for the newly loaded instance before its values
+// are published. It is not called for files loaded to be inspected, such as
+// by the config validate and diff commands. An error from Validate or
+// AfterLoad fails the load, or rejects the reload.
+type (
+	Defaulter interface {
+		SetDefaults()
+	}
+	Normalizer interface {
+		Normalize()
+	}
+	Validator interface {
+		Validate() error
+	}
+	AfterLoader interface {
+		AfterLoad(ctx context.Context) error
+	}
+)
+
+type lifecycleFunc func(v interface{}, key string) error
+
+// ****** Lifecycle ***********************************************************
+
+// completeLoad runs the lifecycle, up to and including Validate, over the
+// configuration and the configurations of the selected commands.
+func (c *Configuration) completeLoad() error {
+	err := c.walkLifecycle(func(v interface{}, key string) error {
+		if d, ok := v.(Defaulter); ok {
+			d.SetDefaults()
+		}
+		return nil
+	})
+	if err == nil {
+		err = c.walkLifecycle(func(v interface{}, key string) error {
+			if n, ok := v.(Normalizer); ok {
+				n.Normalize()
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return c.validateLoad()
+}
+
+// validateLoad checks the validate tags and calls Validate over the
+// configuration and the configurations of the selected commands.
+func (c *Configuration) validateLoad() error {
+	// Every setting failing its validate tag is reported together.
+	var errs []error
+	validate := func(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+		errs = appendError(errs, c.processValidate(fv, ft, level, key))
+		return nil
+	}
+	_ = walkStructure(c.root, 0, "", validate)
+	for _, b := range c.bindings {
+		_ = c.walkBinding(b, validate)
+	}
+	if err := joinErrors(errs); err != nil {
+		return err
+	}
+	return c.walkLifecycle(func(v interface{}, key string) error {
+		if val, ok := v.(Validator); ok {
+			if err := val.Validate(); err != nil {
+				return c.lifecycleError(ErrValidateCoreConfig, key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// afterLoad calls AfterLoad over the configuration and the configurations of
+// the selected commands.
+func (c *Configuration) afterLoad(ctx context.Context) error {
+	return c.walkLifecycle(func(v interface{}, key string) error {
+		if a, ok := v.(AfterLoader); ok {
+			if err := a.AfterLoad(ctx); err != nil {
+				return c.lifecycleError(ErrAfterLoadCoreConfig, key, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Configuration) walkLifecycle(f lifecycleFunc) error {
+	if err := walkLifecycle(c.root, "", f); err != nil {
+		return err
+	}
+	for _, b := range c.bindings {
+		if err := walkLifecycle(b.config, b.prefix, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkLifecycle calls f for s and every struct nested in it, following the
+// same fields as walkStructure, nested structs first.
+func walkLifecycle(s interface{}, key string, f lifecycleFunc) error {
+	rv := reflect.ValueOf(s)
+	rt := reflect.TypeOf(s)
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+		rt = rt.Elem()
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		fv := rv.Field(i)
+		ft := rt.Field(i)
+		name, inline, ok := settingName(rt, ft)
+		if !ok || isLeafType(ft.Type) {
+			continue
+		}
+		if !ft.IsExported() {
+			fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		}
+		path := key
+		if !inline {
+			path = joinPath(key, name)
+		}
+		var err error
+		switch {
+		case fv.Kind() == reflect.Struct:
+			err = walkLifecycle(fv.Addr().Interface(), path, f)
+		case fv.Kind() == reflect.Pointer && !fv.IsNil():
+			err = walkLifecycle(fv.Interface(), path, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return f(s, key)
+}
+
+func (c *Configuration) lifecycleError(code ErrorCode, key string, err error) error {
+	e := &InvalidInitConfigError{Code: code, Path: key, err: err}
+	if pos, ok := c.positions[key]; ok && key != "" {
+		e.File, e.Line, e.Column = pos.file, pos.line, pos.column
+	}
+	return e
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type lifecycleTLS struct {
+	calls *[]string
+	Cert  string `yaml:"cert"`
+	Key   string `yaml:"key"`
+}
+
+type lifecycleConfig struct {
+	calls  []string
+	Mode   string         `yaml:"mode" validate:"oneof=dev prod"`
+	Listen string         `yaml:"listen"`
+	TLS    *lifecycleTLS  `yaml:"tls"`
+	Core   *Configuration `yaml:"core"`
+	loaded int
+}
+
+func (t *lifecycleTLS) record(call string) {
+	if t.calls != nil {
+		*t.calls = append(*t.calls, call)
+	}
+}
+func (t *lifecycleTLS) SetDefaults() {
+	t.record("tls.SetDefaults")
+}
+func (t *lifecycleTLS) Validate() error {
+	t.record("tls.Validate")
+	if (t.Cert == "") != (t.Key == "") {
+		return fmt.Errorf("cert and key must be set together")
+	}
+	return nil
+}
+
+func (l *lifecycleConfig) SetDefaults() {
+	l.calls = append(l.calls, "SetDefaults")
+	if l.Listen == "" {
+		l.Listen = ":8080"
+	}
+}
+func (l *lifecycleConfig) Normalize() {
+	l.calls = append(l.calls, "Normalize")
+	l.Mode = strings.ToLower(strings.TrimSpace(l.Mode))
+}
+func (l *lifecycleConfig) Validate() error {
+	l.calls = append(l.calls, "Validate")
+	if l.Mode == "prod" && l.TLS.Cert == "" {
+		return fmt.Errorf("prod mode requires tls")
+	}
+	return nil
+}
+func (l *lifecycleConfig) AfterLoad(ctx context.Context) error {
+	l.calls = append(l.calls, "AfterLoad")
+	l.loaded++
+	if l.Listen == "fail" {
+		return fmt.Errorf("cannot listen")
+	}
+	return nil
+}
+
+func initLifecycle(t *testing.T, content string) (*lifecycleConfig, string, error) {
+	file := writeManaged(t, "config.yaml", content)
+	config := &lifecycleConfig{}
+	config.TLS = &lifecycleTLS{calls: &config.calls}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	return config, file, err
+}
+
+func Test_Lifecycle(t *testing.T) {
+	config, _, err := initLifecycle(t, "mode: ' DEV '\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tls.SetDefaults", "SetDefaults", "Normalize", "tls.Validate", "Validate", "AfterLoad"}, config.calls)
+	assert.Equal(t, "dev", config.Mode)
+	assert.Equal(t, ":8080", config.Listen)
+
+	_, _, err = initLifecycle(t, "mode: prod\n")
+	if assert.Error(t, err) {
+		assert.Equal(t, "prod mode requires tls", err.Error())
+	}
+
+	_, file, err := initLifecycle(t, "mode: dev\ntls:\n  cert: a.pem\n")
+	if assert.Error(t, err) {
+		assert.Equal(t, file+":3:3: tls: cert and key must be set together", err.Error())
+	}
+
+	_, _, err = initLifecycle(t, "mode: dev\nlisten: fail\n")
+	if assert.Error(t, err) {
+		assert.Equal(t, "cannot listen", err.Error())
+	}
+}
+
+func Test_LifecycleReload(t *testing.T) {
+	config, file, err := initLifecycle(t, "mode: dev\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, config.loaded)
+
+	// Validation and AfterLoad run on the fresh instance; a failure keeps the
+	// live values.
+	assert.NoError(t, os.WriteFile(file, []byte("mode: dev\nlisten: fail\n"), 0o600))
+	assert.Error(t, config.Core.reloadFile(context.Background()))
+	assert.Equal(t, ":8080", config.Listen)
+
+	assert.NoError(t, os.WriteFile(file, []byte("mode: ' Prod'\ntls:\n  cert: a.pem\n  key: a.key\n"), 0o600))
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+	assert.Equal(t, "prod", config.Mode)
+	assert.Equal(t, 1, config.loaded)
+}
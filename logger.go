@@ -12,18 +12,14 @@ import (
 	"github.com/jfigge/clif/constants/screen"
 )
 
-var (
-	ErrLoggerUnmarshalType = fmt.Errorf("logger error - invalid type")
-)
-
 type Logger struct {
 	history *History
 	sync    sync.Mutex
 	debug   bool
 }
 type loggerConfigurationData struct {
-	level     string `env:"${APPNAME}_LOGGER_LEVEL" file:"logger_level" cmd:"--logger-level" monitored:""`
-	colorized bool   `env:"${APPNAME}_LOGGER_COLORIZED" file:"logger_colorized" cmd:"--logger-colorized"`
+	level     string `env:"${APPNAME}_LOGGER_LEVEL" file:"logger_level" cmd:"--logger-level" monitored:"" default:"info" validate:"oneof=trace debug info warn error" desc:"Minimum level of messages to log"`
+	colorized bool   `env:"${APPNAME}_LOGGER_COLORIZED" file:"logger_colorized" cmd:"--logger-colorized" desc:"Colorize log output"`
 }
 type LoggerConfiguration struct {
 	*loggerConfigurationData
@@ -32,7 +28,7 @@ type LoggerConfiguration struct {
 // ****** Construction ********************************************************
 
 func NewLogger() (*Logger, error) {
-	logger := &Logger{}
+	logger := &Logger{history: &History{}}
 
 	return logger, nil
 }
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy controls how the keys of a setting's path are written when
+// its environment variable or flag name is derived from the path.
+type NamingStrategy int
+
+const (
+	NamingNone           NamingStrategy = iota // names are not derived
+	NamingKebab                                // walkerB -> walker-b
+	NamingSnake                                // walkerB -> walker_b
+	NamingCamel                                // walker_b -> walkerB
+	NamingScreamingSnake                       // walkerB -> WALKER_B
+)
+
+// ****** Naming **************************************************************
+
+// Apply writes a single key of a path in the strategy's style.
+func (n NamingStrategy) Apply(key string) string {
+	words := splitWords(key)
+	switch n {
+	case NamingKebab:
+		return strings.ToLower(strings.Join(words, "-"))
+	case NamingSnake:
+		return strings.ToLower(strings.Join(words, "_"))
+	case NamingScreamingSnake:
+		return strings.ToUpper(strings.Join(words, "_"))
+	case NamingCamel:
+		for i, word := range words {
+			word = strings.ToLower(word)
+			if i > 0 && word != "" {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			}
+			words[i] = word
+		}
+		return strings.Join(words, "")
+	}
+	return key
+}
+
+// splitWords splits a key into words at '_', '-' and spaces, and where the
+// case changes: "HTTPPort" is "HTTP" and "Port", "walkerB" is "walker" and "B".
+func splitWords(key string) []string {
+	var words []string
+	runes := []rune(key)
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		switch {
+		case i == len(runes) || runes[i] == '_' || runes[i] == '-' || runes[i] == ' ':
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(runes[i]) &&
+			(!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return words
+}
+
+// deriveNames fills in the environment variable and flag of a setting that
+// has no env or cmd tag, from the setting's path. Command settings are named
+// from their path below the command, so "commands.serve.port" is --port and
+// APP_SERVE_PORT.
+func (c *Configuration) deriveNames(s *setting) {
+	path := s.path
+	flagPath := path
+	if c.binding != nil {
+		flagPath = strings.TrimPrefix(strings.TrimPrefix(path, c.binding.prefix), ".")
+		path = strings.TrimPrefix(path, "commands.")
+	}
+	if _, ok := s.field.Tag.Lookup("env"); !ok && c.Metadata.envNaming != NamingNone {
+		keys := strings.Split(path, ".")
+		for i, key := range keys {
+			keys[i] = c.Metadata.envNaming.Apply(key)
+		}
+		s.env = c.envPrefix() + "_" + strings.ToUpper(strings.ReplaceAll(strings.Join(keys, "_"), "-", "_"))
+	}
+	if _, ok := s.field.Tag.Lookup("cmd"); !ok && c.Metadata.flagNaming != NamingNone && flagPath != "" {
+		keys := strings.Split(flagPath, ".")
+		for i, key := range keys {
+			keys[i] = c.Metadata.flagNaming.Apply(key)
+		}
+		s.cmd = "--" + strings.Join(keys, ".")
+	}
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionDeriveNames gives every setting without an env or cmd
+// tag an environment variable and a flag named after its path, writing each
+// key with the env and flag strategies. The variable is prefixed with the
+// application name and upper-cased, so with NamingCamel and NamingKebab
+// walkerB.walkerC.external is APP_WALKERB_WALKERC_EXTERNAL and
+// --walker-b.walker-c.external. Pass NamingNone to derive only one of them;
+// a tag of "-" leaves a setting without a variable or flag.
+func ConfigurationOptionDeriveNames(env NamingStrategy, flag NamingStrategy) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.envNaming = env
+		c.Metadata.flagNaming = flag
+		return nil
+	}
+}
+
+// ConfigurationOptionIgnoreKeyCase matches the keys of the configuration file
+// to settings regardless of case, so Port, PORT and port are the same key.
+func ConfigurationOptionIgnoreKeyCase() ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.ignoreKeyCase = true
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type namingWalkerC struct {
+	External string `yaml:"external"`
+	HTTPPort int    `yaml:"HTTPPort"`
+}
+
+type namingWalkerB struct {
+	WalkerC namingWalkerC `yaml:"walkerC"`
+}
+
+type namingConfig struct {
+	WalkerB  namingWalkerB  `yaml:"walkerB"`
+	Explicit string         `yaml:"explicit" env:"EXPLICIT" cmd:"--explicit"`
+	Hidden   string         `yaml:"hidden" env:"-" cmd:"-"`
+	Core     *Configuration `yaml:"core"`
+}
+
+func Test_NamingStrategy(t *testing.T) {
+	tests := map[string][5]string{
+		"walkerB":   {"walker-b", "walker_b", "walkerB", "WALKER_B", "walkerB"},
+		"HTTPPort":  {"http-port", "http_port", "httpPort", "HTTP_PORT", "HTTPPort"},
+		"log_level": {"log-level", "log_level", "logLevel", "LOG_LEVEL", "log_level"},
+		"external":  {"external", "external", "external", "EXTERNAL", "external"},
+	}
+	for key, expected := range tests {
+		for i, n := range []NamingStrategy{NamingKebab, NamingSnake, NamingCamel, NamingScreamingSnake, NamingNone} {
+			assert.Equal(t, expected[i], n.Apply(key), "%s %d", key, n)
+		}
+	}
+}
+
+func Test_DeriveNames(t *testing.T) {
+	tests := map[string]struct {
+		env   NamingStrategy
+		flag  NamingStrategy
+		names map[string][2]string
+	}{
+		"Camel and kebab": {
+			env:  NamingCamel,
+			flag: NamingKebab,
+			names: map[string][2]string{
+				"walkerB.walkerC.external": {"APP_WALKERB_WALKERC_EXTERNAL", "--walker-b.walker-c.external"},
+				"walkerB.walkerC.HTTPPort": {"APP_WALKERB_WALKERC_HTTPPORT", "--walker-b.walker-c.http-port"},
+				"explicit":                 {"EXPLICIT", "--explicit"},
+				"hidden":                   {"", ""},
+			},
+		},
+		"Screaming snake and snake": {
+			env:  NamingScreamingSnake,
+			flag: NamingSnake,
+			names: map[string][2]string{
+				"walkerB.walkerC.HTTPPort": {"APP_WALKER_B_WALKER_C_HTTP_PORT", "--walker_b.walker_c.http_port"},
+			},
+		},
+		"Flags only": {
+			flag: NamingCamel,
+			names: map[string][2]string{
+				"walkerB.walkerC.external": {"", "--walkerB.walkerC.external"},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &namingConfig{}
+			err := InitConfig(
+				context.Background(), config,
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(""),
+				ConfigurationOptionAppName("app"),
+				ConfigurationOptionEnvironment(mapEnv{}),
+				ConfigurationOptionDeriveNames(test.env, test.flag),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for path, names := range test.names {
+				s := config.Core.setting(path)
+				if assert.NotNil(t, s, path) {
+					assert.Equal(t, names[0], s.env, path)
+					assert.Equal(t, names[1], s.cmd, path)
+				}
+			}
+		})
+	}
+}
+
+func Test_DeriveNamesLoad(t *testing.T) {
+	config := &namingConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(""),
+		ConfigurationOptionAppName("app"),
+		ConfigurationOptionEnvironment(mapEnv{"APP_WALKERB_WALKERC_EXTERNAL": "env", "APP_HIDDEN": "env"}),
+		ConfigurationOptionArgs([]string{"--walker-b.walker-c.http-port", "8080"}),
+		ConfigurationOptionDeriveNames(NamingCamel, NamingKebab),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "env", config.WalkerB.WalkerC.External)
+	assert.Equal(t, 8080, config.WalkerB.WalkerC.HTTPPort)
+	assert.Equal(t, "", config.Hidden)
+}
+
+func Test_IgnoreKeyCase(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "WALKERB:\n  walkerc:\n    External: file\n    httpport: 80\n")
+	config := &namingConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if assert.Error(t, err) {
+		assert.Equal(t, file+":1:1: WALKERB: unknown key", err.Error())
+	}
+
+	config = &namingConfig{}
+	err = InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionIgnoreKeyCase(),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "file", config.WalkerB.WalkerC.External)
+	assert.Equal(t, 80, config.WalkerB.WalkerC.HTTPPort)
+	pos := config.Core.positions["walkerB.walkerC.HTTPPort"]
+	assert.Equal(t, 4, pos.line)
+
+	// Saving updates the keys as they are written in the file.
+	assert.NoError(t, config.Core.Persist("walkerB.walkerC.HTTPPort", 81))
+	bs, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "WALKERB:\n  walkerc:\n    External: file\n    httpport: 81\n", string(bs))
+}
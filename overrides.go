@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	setFlag          = "--set"
+	configFlag       = "--config"
+	configFormatFlag = "--config-format"
+	stdinFile        = "-"
+	stdinName        = "<stdin>"
+)
+
+// builtinFlags are the flags parsed before those of the settings.
+var builtinFlags = []string{"-h", "--help", versionFlag, completionFlag, completeFlag, setFlag, configFlag, configFormatFlag}
+
+// ****** Overrides ***********************************************************
+
+// flagArg returns the value of the flag at args[*i], given either as
+// --flag=value or as the next argument.
+func flagArg(args []string, i *int) (string, error) {
+	name, value, ok := strings.Cut(args[*i], "=")
+	if ok {
+		return value, nil
+	}
+	if *i+1 < len(args) {
+		*i++
+		return args[*i], nil
+	}
+	return "", &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: name, err: fmt.Errorf("missing value")}
+}
+
+// parseSet records a --set key=value override of the setting at the dotted
+// path key.
+func (c *Configuration) parseSet(arg string) error {
+	path, value, ok := strings.Cut(arg, "=")
+	if !ok {
+		return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: setFlag, err: fmt.Errorf("expected key=value, got %q", arg)}
+	}
+	if c.setting(path) == nil {
+		return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: setFlag, err: fmt.Errorf("unknown setting %q", path)}
+	}
+	c.sets[path] = value
+	return nil
+}
+
+// processSet applies the --set overrides, above every other source.
+func (c *Configuration) processSet(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+	value, ok := c.sets[key]
+	if !ok {
+		return nil
+	}
+	if err := setFromYAML(fv, value); err != nil {
+		return &InvalidInitConfigError{Code: ErrTypeCoreConfig, Path: setFlag + " " + key, err: fmt.Errorf("expected %s", typeName(ft.Type))}
+	}
+	c.setting(key).source = sourceSet
+	return nil
+}
+
+// setFromYAML decodes a --set value as the configuration file would, so that
+// quoting, null and flow sequences and mappings mean the same in both. A list
+// may also be given comma-separated, as it is to a flag.
+func setFromYAML(fv reflect.Value, value string) error {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal([]byte(value), doc); err != nil {
+		return err
+	}
+	target := reflect.New(fv.Type())
+	if len(doc.Content) > 0 {
+		node := doc.Content[0]
+		if fv.Kind() == reflect.Slice && node.Kind == yaml.ScalarNode && node.Tag != "!!null" {
+			return setFromString(fv, value)
+		}
+		if err := node.Decode(target.Interface()); err != nil {
+			return err
+		}
+	}
+	fv.Set(target.Elem())
+	return nil
+}
+
+// parseConfigFormat checks the format given by --config-format.
+func (c *Configuration) parseConfigFormat(format string) error {
+	switch format = strings.ToLower(format); format {
+	case "yaml", "yml", "json":
+		c.Metadata.configFormat = format
+		return nil
+	}
+	return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: configFormatFlag, err: fmt.Errorf("unknown format %q", format)}
+}
+
+// formatOf returns the format of file, which for the configuration file may
+// be given by --config-format rather than its extension.
+func (c *Configuration) formatOf(file string) string {
+	if c.Metadata.configFormat != "" && (file == c.Metadata.configFile || file == stdinName) {
+		return c.Metadata.configFormat
+	}
+	return fileFormat(file)
+}
+
+// readStdin reads the configuration document given by --config -. Standard
+// input can only be read once, so a reload sees the same document.
+func (c *Configuration) readStdin() ([]byte, error) {
+	if c.Metadata.stdinConfig == nil {
+		bs, err := io.ReadAll(c.Metadata.input)
+		if err != nil {
+			return nil, &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
+		}
+		c.Metadata.stdinConfig = append([]byte{}, bs...)
+	}
+	return c.Metadata.stdinConfig, nil
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionInput sets where the configuration is read from when
+// given as --config -, by default standard input.
+func ConfigurationOptionInput(input io.Reader) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.input = input
+		return nil
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type overrideConfig struct {
+	Name string         `yaml:"name" cmd:"--name" env:"OVERRIDE_NAME"`
+	Port int            `yaml:"port" default:"8080" validate:"min=1024"`
+	Tags []string       `yaml:"tags"`
+	Core *Configuration `yaml:"core"`
+}
+
+func Test_Set(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: file\nport: 9000\n")
+	tests := map[string]struct {
+		args    []string
+		name    string
+		port    int
+		tags    []string
+		sources map[string]string
+		error   string
+	}{
+		"Highest precedence": {
+			args:    []string{"--name", "flag", "--set", "name=set", "--set=port=9100", "--set", "tags=a, b"},
+			name:    "set",
+			port:    9100,
+			tags:    []string{"a", "b"},
+			sources: map[string]string{"name": "set", "port": "set", "tags": "set"},
+		},
+		"Last wins": {
+			args:    []string{"--set", "port=9100", "--set", "port=9200"},
+			name:    "env",
+			port:    9200,
+			sources: map[string]string{"name": "env", "port": "set"},
+		},
+		"Missing value":  {args: []string{"--set"}, error: "--set: missing value"},
+		"Not key=value":  {args: []string{"--set", "port"}, error: `--set: expected key=value, got "port"`},
+		"Unknown":        {args: []string{"--set", "host=x"}, error: `--set: unknown setting "host"`},
+		"Type":           {args: []string{"--set", "port=high"}, error: "--set port: expected int"},
+		"Validated":      {args: []string{"--set", "port=80"}, error: "port: must be at least 1024"},
+		"Set is a value": {args: []string{"--set", "name=a=b"}, name: "a=b", port: 9000},
+		// Values are decoded as they would be in the file.
+		"YAML": {
+			args: []string{"--set", `name="quoted, spaced "`, "--set", "port=0x2400", "--set", "tags=[x, 'y, z']"},
+			name: "quoted, spaced ",
+			port: 9216,
+			tags: []string{"x", "y, z"},
+		},
+		"YAML null": {args: []string{"--set", "name=~"}, name: "", port: 9000},
+		"YAML type": {args: []string{"--set", "port=[1]"}, error: "--set port: expected int"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &overrideConfig{}
+			err := InitConfig(
+				context.Background(), config,
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(file),
+				ConfigurationOptionEnvironment(mapEnv{"OVERRIDE_NAME": "env"}),
+				ConfigurationOptionArgs(test.args),
+			)
+			if test.error != "" {
+				if assert.Error(t, err) {
+					assert.Equal(t, test.error, err.Error())
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.name, config.Name)
+			assert.Equal(t, test.port, config.Port)
+			assert.Equal(t, test.tags, config.Tags)
+			for path, source := range test.sources {
+				assert.Equal(t, source, config.Core.setting(path).source, path)
+			}
+
+			// Overrides survive a reload.
+			assert.NoError(t, config.Core.Reload(context.Background()))
+			assert.Equal(t, test.port, config.Port)
+		})
+	}
+}
+
+func Test_BuiltinFlagShadowed(t *testing.T) {
+	type shadowConfig struct {
+		File string         `yaml:"file" cmd:"--config"`
+		Core *Configuration `yaml:"core"`
+	}
+	type aliasConfig struct {
+		Release string         `yaml:"release" cmd:"--release" alias:"--version"`
+		Core    *Configuration `yaml:"core"`
+	}
+	type derivedConfig struct {
+		Set  string         `yaml:"set"`
+		Core *Configuration `yaml:"core"`
+	}
+	for name, test := range map[string]struct {
+		config  interface{}
+		options []ConfigurationOption
+		error   string
+	}{
+		"Tag":     {config: &shadowConfig{}, error: "file: flag --config is built in"},
+		"Alias":   {config: &aliasConfig{}, error: "release: flag --version is built in"},
+		"Derived": {config: &derivedConfig{}, options: []ConfigurationOption{ConfigurationOptionDeriveNames(NamingNone, NamingKebab)}, error: "set: flag --set is built in"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := InitConfig(context.Background(), test.config, append([]ConfigurationOption{
+				configurationOptionNoWatch(),
+				ConfigurationOptionConfigFile(""),
+			}, test.options...)...)
+			if assert.Error(t, err) {
+				assert.ErrorIs(t, err, ErrFlagCoreConfig)
+				assert.Equal(t, test.error, err.Error())
+			}
+		})
+	}
+}
+
+func Test_SetNotSaved(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: file\n")
+	config := &overrideConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+		ConfigurationOptionArgs([]string{"--set", "port=9100"}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// An override from the command line is not written back to the file.
+	assert.NoError(t, config.Core.Save())
+	bs, _ := os.ReadFile(file)
+	assert.Equal(t, "name: file\n", string(bs))
+}
+
+func Test_ConfigStdin(t *testing.T) {
+	load := func(input string, args ...string) (*overrideConfig, error) {
+		config := &overrideConfig{}
+		err := InitConfig(
+			context.Background(), config,
+			configurationOptionNoWatch(),
+			ConfigurationOptionEnvironment(mapEnv{}),
+			ConfigurationOptionInput(strings.NewReader(input)),
+			ConfigurationOptionArgs(args),
+		)
+		return config, err
+	}
+
+	config, err := load("name: stdin\nport: 9300\n", "--config", "-", "--set", "port=9400")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "stdin", config.Name)
+		assert.Equal(t, 9400, config.Port)
+		assert.Equal(t, "-", config.Core.Metadata.ConfigFile())
+		assert.Equal(t, sourceFile, config.Core.setting("name").source)
+		assert.NoError(t, config.Core.Reload(context.Background()))
+		assert.Equal(t, "stdin", config.Name)
+		if err = config.Core.Persist("port", 9500); assert.Error(t, err) {
+			assert.Equal(t, "configuration error - configuration read from <stdin>", err.Error())
+		}
+	}
+
+	config, err = load(`{"name": "json", "tags": ["x"]}`, "--config=-", "--config-format", "JSON")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "json", config.Name)
+		assert.Equal(t, []string{"x"}, config.Tags)
+	}
+
+	_, err = load("name: x\nport: high\n", "--config", "-")
+	if assert.Error(t, err) {
+		assert.Equal(t, "<stdin>:2:7: port: expected int", err.Error())
+	}
+	_, err = load("", "--config", "-", "--config-format", "toml")
+	if assert.Error(t, err) {
+		assert.Equal(t, `--config-format: unknown format "toml"`, err.Error())
+	}
+
+	file := writeManaged(t, "settings.conf", `{"name": "conf"}`)
+	config, err = load("", "--config", file, "--config-format=json")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "conf", config.Name)
+		assert.NoError(t, config.Core.Persist("port", 9600))
+		bs, _ := config.Core.Metadata.fileSystem.ReadFile(file)
+		assert.Equal(t, "{\n  \"name\": \"conf\",\n  \"port\": 9600\n}\n", string(bs))
+	}
+}
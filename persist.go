@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// ****** Persistence *********************************************************
+
+// Persist changes the setting at the dotted path to value and writes it to
+// the configuration file. value may be of the setting's type or a string in
+// the form accepted on the command line. Comments, ordering and the other
+// settings in the file are left as they are.
+func (c *Configuration) Persist(path string, value interface{}) error {
+	if err := c.setValue(path, value, sourceSet); err != nil {
+		return err
+	}
+	return c.persist(path)
+}
+
+// Save writes every setting that was read from the configuration file, set
+// through Set or Persist, or changed since it was loaded back to the file.
+// Settings that only hold their default, or that came from the environment or
+// command line, are not written.
+func (c *Configuration) Save() error {
+	var paths []string
+	for _, s := range c.settings {
+		// --set overrides are labelled as Set values, but came from the
+		// command line.
+		if _, override := c.sets[s.path]; s.command != nil || override {
+			continue
+		}
+		if s.source == sourceFile || s.source == sourceSet || !reflect.DeepEqual(s.loaded, s.value.Interface()) {
+			paths = append(paths, s.path)
+		}
+	}
+	return c.persist(paths...)
+}
+
+// persist writes the current values of the settings at paths into the
+// configuration file through its yaml.Node tree, creating the file if needed.
+// It holds the reload lock so the watcher's reload of our own write waits
+// until the hash of the new content has been recorded.
+func (c *Configuration) persist(paths ...string) error {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	file := c.Metadata.configFile
+	if file == "" {
+		return &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: fmt.Errorf("no configuration file")}
+	}
+	if file == stdinFile {
+		return &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: fmt.Errorf("configuration read from %s", stdinName)}
+	}
+	doc := &document{file: file, format: c.formatOf(file), rt: reflect.TypeOf(c.root)}
+	bs, err := c.Metadata.fileSystem.ReadFile(file)
+	if err == nil {
+		if doc, err = parseDocument(file, c.formatOf(file), bs); err != nil {
+			return err
+		}
+		doc.ignoreCase = c.Metadata.ignoreKeyCase
+		doc.rt = reflect.TypeOf(c.root)
+		// Renamed keys are migrated to their current names as the file is
+		// written.
+		if _, err = doc.rename(c.fileAliases()); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
+	}
+
+	c.lock.Lock()
+	for _, path := range paths {
+		s := c.setting(path)
+		if s == nil {
+			c.lock.Unlock()
+			return &InvalidInitConfigError{Code: ErrUnknownKeyCoreConfig, Path: path, err: fmt.Errorf("unknown setting")}
+		}
+		if err = doc.set(path, s.value.Interface()); err != nil {
+			c.lock.Unlock()
+			return err
+		}
+	}
+	c.lock.Unlock()
+
+	if bs, err = doc.encode(); err != nil {
+		return err
+	}
+	// The watcher sees our own write; recording its hash first lets the
+	// reload recognize the content and skip it.
+	c.lock.Lock()
+	previous, content := c.fileHash, c.fileContent
+	c.fileHash, c.fileContent = sha256.Sum256(bs), bs
+	c.lock.Unlock()
+	if err = c.Metadata.fileSystem.WriteFile(file, bs); err != nil {
+		c.lock.Lock()
+		c.fileHash, c.fileContent = previous, content
+		c.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic replaces file with data by writing a temporary file in the
+// same directory and renaming it over the original, so readers never see a
+// partial file. A symlinked file has its target replaced, not the link.
+func writeFileAtomic(file string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(file); err == nil {
+		file = target
+	}
+	mode := fs.FileMode(0o600)
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
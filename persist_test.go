@@ -0,0 +1,203 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type persistConfig struct {
+	Theme string         `yaml:"theme" default:"light" validate:"oneof=light dark"`
+	Port  int            `yaml:"port" env:"${APPNAME}_PORT"`
+	Name  string         `yaml:"name"`
+	Core  *Configuration `yaml:"core"`
+}
+
+const persistYAML = `# display settings
+name: demo # service name
+
+# listener
+port: 8080
+`
+
+func Test_Persist(t *testing.T) {
+	file := writeManaged(t, "config.yaml", persistYAML)
+	config := &persistConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notified []interface{}
+	config.Core.AddNotifyOnChange("theme", func(setting string, value interface{}) {
+		notified = append(notified, value)
+	})
+
+	assert.NoError(t, config.Core.Persist("theme", "dark"))
+	assert.Equal(t, "dark", config.Theme)
+	assert.Equal(t, []interface{}{"dark"}, notified)
+	assert.NoError(t, config.Core.Persist("port", 9090))
+	assert.Equal(t, 9090, config.Port)
+
+	bs, _ := os.ReadFile(file)
+	assert.Equal(t, `# display settings
+name: demo # service name
+# listener
+port: 9090
+theme: dark
+`, string(bs))
+	entries, _ := os.ReadDir(filepath.Dir(file))
+	assert.Len(t, entries, 1)
+
+	err = config.Core.Persist("theme", "blue")
+	if assert.Error(t, err) {
+		assert.Equal(t, "theme: must be one of light, dark", err.Error())
+	}
+}
+
+func Test_PersistJSONTags(t *testing.T) {
+	// A JSON file is written under the json tags it is read with.
+	file := writeManaged(t, "c.json", `{"my_field": "a", "nested_block": {"count": 2}}`)
+	config := &jsonConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, config.Core.Persist("myfield", "b"))
+	assert.NoError(t, config.Core.Persist("nested.count", 3))
+	bs, _ := os.ReadFile(file)
+	assert.JSONEq(t, `{"my_field": "b", "nested_block": {"count": 3}}`, string(bs))
+
+	// The file written loads again.
+	config = &jsonConfig{}
+	err = InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "b", config.MyField)
+		assert.Equal(t, 3, config.Nested.Count)
+	}
+}
+
+func Test_Save(t *testing.T) {
+	t.Setenv("DEMO_PORT", "7000")
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	config := &persistConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionAppName("demo"),
+		ConfigurationOptionConfigFile(file),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	config.Name = "renamed"
+	config.Core.Console.SetWidth(120)
+	assert.NoError(t, config.Core.Save())
+
+	bs, _ := os.ReadFile(file)
+	assert.Equal(t, "name: renamed\ncore:\n  console:\n    width: 120\n", string(bs))
+}
+
+// watchedFS is a file system in memory whose watcher queues a change for
+// every write. WriteFile gives the watch loop a moment to read the file
+// again before returning, as a fast file system notification would.
+type watchedFS struct {
+	lock    sync.Mutex
+	files   map[string][]byte
+	changes chan struct{}
+	read    chan struct{}
+}
+
+func (f *watchedFS) ReadFile(name string) ([]byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	select {
+	case f.read <- struct{}{}:
+	default:
+	}
+	bs, ok := f.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte{}, bs...), nil
+}
+func (f *watchedFS) WriteFile(name string, data []byte) error {
+	f.lock.Lock()
+	f.files[name] = append([]byte{}, data...)
+	select {
+	case <-f.read:
+	default:
+	}
+	f.lock.Unlock()
+	select {
+	case f.changes <- struct{}{}:
+	default:
+	}
+	select {
+	case <-f.read:
+	case <-time.After(20 * time.Millisecond):
+	}
+	return nil
+}
+func (f *watchedFS) Stat(name string) (fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+func (f *watchedFS) Watch(name string) (FileWatcher, error) { return f, nil }
+func (f *watchedFS) Changes() <-chan struct{}               { return f.changes }
+func (f *watchedFS) Errors() <-chan error                   { return nil }
+func (f *watchedFS) Close() error                           { return nil }
+
+func Test_PersistSuppressesReload(t *testing.T) {
+	fsys := &watchedFS{files: map[string][]byte{"config.yaml": []byte(persistYAML)}, changes: make(chan struct{}, 100), read: make(chan struct{}, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	config := &persistConfig{}
+	errs := make(chan error, 10)
+	err := InitConfig(
+		ctx, config,
+		ConfigurationOptionConfigFile("config.yaml"),
+		ConfigurationOptionFileSystem(fsys),
+		ConfigurationOptionEnvironment(mapEnv{}),
+		ConfigurationOptionWaitGroup(wg),
+		ConfigurationOptionErrorNotify(func(err error) { errs <- err }),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	reloads := make(chan int, 100)
+	OnReload(config.Core, func(old *persistConfig, new *persistConfig) error {
+		reloads <- new.Port
+		return nil
+	})
+
+	// Changes are handled in order, so the first reload observed after our
+	// own writes is that of the file written by someone else.
+	for port := 8081; port <= 8090; port++ {
+		assert.NoError(t, config.Core.Persist("port", port))
+	}
+	assert.NoError(t, fsys.WriteFile("config.yaml", []byte("port: 9000\n")))
+	select {
+	case port := <-reloads:
+		assert.Equal(t, 9000, port)
+	case err = <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload not observed")
+	}
+	assert.Empty(t, reloads)
+	assert.Empty(t, errs)
+}
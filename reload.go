@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// ****** Reload **************************************************************
+
+func (c *Configuration) watchConfigFile() error {
+	var err error
+	c.Metadata.fileWatcher, err = c.Metadata.fileSystem.Watch(c.Metadata.configFile)
+	return err
+}
+
+// Reload re-reads the configuration file, environment and command line and
+// publishes the settings that changed, even when the file itself has not.
+func (c *Configuration) Reload(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.reload(ctx, true, auditReload)
+}
+
+// reloadFile re-reads the configuration file and publishes the settings that
+// changed. Content identical to what was last loaded or written, such as the
+// echo of our own Save, is ignored.
+func (c *Configuration) reloadFile(ctx context.Context) error {
+	return c.reload(ctx, false, auditReload)
+}
+
+// reload loads a fresh instance of the configuration and publishes it. A
+// reload that fails AfterLoad, or is rejected by an OnReload hook, leaves the
+// live configuration as it was.
+func (c *Configuration) reload(ctx context.Context, force bool, trigger string) error {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	return c.reloadLocked(ctx, force, trigger)
+}
+
+// reloadLocked is reload for a caller holding the reload lock.
+func (c *Configuration) reloadLocked(ctx context.Context, force bool, trigger string) error {
+	bs, err := c.readConfigFile()
+	if err != nil {
+		c.recordReload(trigger, nil, err)
+		return err
+	}
+	hash := sha256.Sum256(bs)
+	c.lock.Lock()
+	unchanged := hash == c.fileHash
+	c.lock.Unlock()
+	if unchanged && !force {
+		return nil
+	}
+	return c.reloadContent(ctx, bs, trigger)
+}
+
+// reloadContent loads a fresh instance of the configuration from the file
+// content bs and publishes it.
+func (c *Configuration) reloadContent(ctx context.Context, bs []byte, trigger string) error {
+	fresh, err := c.loadInstance(c.Metadata.configFile, bs, true)
+	if err != nil {
+		c.recordReload(trigger, nil, err)
+		return err
+	}
+	diff, err := c.apply(ctx, fresh, bs, trigger)
+	c.recordReload(trigger, diff, err)
+	return err
+}
+
+// apply runs AfterLoad, the read-only check and the OnReload hooks on a
+// configuration freshly loaded from the file content bs and, when none
+// objects, publishes it and audits the changes as made by trigger.
+func (c *Configuration) apply(ctx context.Context, fresh *Configuration, bs []byte, trigger string) (Diff, error) {
+	if err := fresh.afterLoad(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.checkReadonly(fresh); err != nil {
+		return nil, err
+	}
+	if err := c.vetoReload(fresh); err != nil {
+		return nil, err
+	}
+	env := fresh.envSnapshot()
+	c.lock.Lock()
+	c.fileHash = sha256.Sum256(bs)
+	c.fileContent = bs
+	c.positions = fresh.positions
+	c.envValues = env
+	c.lock.Unlock()
+	diff := c.publish(fresh)
+	c.audit(diff, trigger)
+	c.restartRequired(diff)
+	return diff, nil
+}
+
+// checkReadonly rejects a freshly loaded configuration that changes a setting
+// tagged readonly from the value it was first loaded with.
+func (c *Configuration) checkReadonly(fresh *Configuration) error {
+	for _, f := range fresh.settings {
+		s := c.setting(f.path)
+		if !f.readonly || f.command != nil || s == nil || reflect.DeepEqual(s.loaded, f.value.Interface()) {
+			continue
+		}
+		e := &InvalidInitConfigError{Code: ErrReloadCoreConfig, File: c.Metadata.configFile, Path: f.path,
+			err: fmt.Errorf("read-only setting changed, restart to apply")}
+		if pos, ok := fresh.positions[f.path]; ok {
+			e.File, e.Line, e.Column = pos.file, pos.line, pos.column
+		}
+		return e
+	}
+	return nil
+}
+
+// restartRequired records the settings tagged restart in diff and calls the
+// restart hooks with them.
+func (c *Configuration) restartRequired(diff Diff) {
+	var paths []string
+	for _, change := range diff {
+		if s := c.setting(change.Path); s != nil && s.restart {
+			paths = append(paths, change.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	c.lock.Lock()
+	for _, path := range paths {
+		if !contains(c.restarts, path) {
+			c.restarts = append(c.restarts, path)
+		}
+	}
+	restartFuncs := append([]ConfigurationRestartFunc{}, c.restartFuncs...)
+	c.lock.Unlock()
+
+	if len(restartFuncs) == 0 {
+		c.warn("restart required: " + strings.Join(paths, ", "))
+	}
+	for _, restartFunc := range restartFuncs {
+		restartFunc(paths)
+	}
+}
+
+// loadInstance decodes bs into a fresh instance of the configuration type and
+// applies defaults, and when overlay is set the environment and command line,
+// over it. The live configuration is left untouched.
+func (c *Configuration) loadInstance(file string, bs []byte, overlay bool) (*Configuration, error) {
+	root := reflect.New(reflect.TypeOf(c.root).Elem()).Interface()
+	positions, err := c.decodeConfig(file, bs, root)
+	if err != nil {
+		return nil, err
+	}
+	fresh := &Configuration{
+		configurationData: &configurationData{positions: positions, flags: c.flags, sets: c.sets, root: root},
+		Metadata:          c.Metadata,
+	}
+	fs := []processFunc{fresh.collectSetting, fresh.processDefault}
+	if overlay {
+		fs = append(fs, fresh.processEnvVar, fresh.processFlag, fresh.processSet)
+	}
+	fs = append(fs, fresh.processDeprecated)
+	if err = walkStructure(root, 0, "", fs...); err != nil {
+		return nil, err
+	}
+	if err = fresh.completeLoad(); err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// publish copies the values of a freshly loaded configuration into the live
+// one. The changes come from the same diff that DiffEffective reports, and
+// the monitors of each changed setting are notified.
+func (c *Configuration) publish(fresh *Configuration) Diff {
+	c.lock.Lock()
+	diff := diffSettings(c.settings, fresh.settings, false)
+	for _, f := range fresh.settings {
+		if s := c.setting(f.path); s != nil && s.command == nil {
+			s.value.Set(f.value)
+			s.source = f.source
+		}
+	}
+	c.lock.Unlock()
+	for _, change := range diff {
+		c.notify(change.Path, change.New)
+	}
+	return diff
+}
+
+func (c *configurationData) notifyError(err error) {
+	if c.errorFunc != nil {
+		c.errorFunc(err)
+		return
+	}
+	log.Println(err)
+}
+
+// warn logs a warning through the configured Logger, or the standard log.
+func (c *Configuration) warn(message string) {
+	if c.Metadata.logger != nil {
+		c.Metadata.logger.Warn(message)
+		return
+	}
+	log.Println(message)
+}
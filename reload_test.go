@@ -0,0 +1,194 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OnReloadVeto(t *testing.T) {
+	file := writeManaged(t, "config.yaml", managedYAML)
+	config := &managedConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	assert.NoError(t, err)
+
+	var seen []int
+	OnReload(config.Core, func(old *managedConfig, new *managedConfig) error {
+		seen = append(seen, old.Port, new.Port)
+		if new.Name == "demo" && new.Port == 9999 {
+			return fmt.Errorf("port 9999 is reserved for %s", new.Name)
+		}
+		return nil
+	})
+	notified := 0
+	config.Core.AddNotifyOnChange("port", func(setting string, value interface{}) { notified++ })
+
+	assert.NoError(t, os.WriteFile(file, []byte("name: demo\nport: 9999\n"), 0o600))
+	err = config.Core.reloadFile(context.Background())
+	if assert.Error(t, err) {
+		assert.Equal(t, file+": reload rejected: port 9999 is reserved for demo", err.Error())
+	}
+	assert.Equal(t, 9000, config.Port)
+	assert.Equal(t, 0, notified)
+
+	assert.NoError(t, os.WriteFile(file, []byte("name: demo\nport: 9001\n"), 0o600))
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+	assert.Equal(t, 9001, config.Port)
+	assert.Equal(t, 1, notified)
+	assert.Equal(t, []int{9000, 9999, 9000, 9001}, seen)
+}
+
+type reloadConfig struct {
+	Name string         `yaml:"name"`
+	Port int            `yaml:"port" env:"CLIF_RELOAD_PORT" default:"8080"`
+	Core *Configuration `yaml:"core"`
+}
+
+func Test_Reload(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	config := &reloadConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	assert.NoError(t, err)
+	assert.Equal(t, 8080, config.Port)
+
+	var changes []interface{}
+	config.Core.AddNotifyOnChange("port", func(setting string, value interface{}) { changes = append(changes, value) })
+
+	// The file is unchanged, so only a forced reload sees the environment.
+	t.Setenv("CLIF_RELOAD_PORT", "9090")
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+	assert.Equal(t, 8080, config.Port)
+	assert.NoError(t, config.Core.Reload(context.Background()))
+	assert.Equal(t, 9090, config.Port)
+	assert.Equal(t, []interface{}{9090}, changes)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, config.Core.Reload(ctx), context.Canceled)
+
+	assert.NoError(t, os.Remove(file))
+	assert.Error(t, config.Core.Reload(context.Background()))
+	assert.Equal(t, "demo", config.Name)
+}
+
+func Test_ReloadSignal(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "name: demo\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	config := &reloadConfig{}
+	errs := make(chan error, 10)
+	err := InitConfig(
+		ctx, config,
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionWaitGroup(wg),
+		ConfigurationOptionReloadSignal(),
+		ConfigurationOptionErrorNotify(func(err error) { errs <- err }),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	changes := make(chan interface{}, 10)
+	config.Core.AddNotifyOnChange("port", func(setting string, value interface{}) { changes <- value })
+
+	t.Setenv("CLIF_RELOAD_PORT", "9191")
+	process, err := os.FindProcess(os.Getpid())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, process.Signal(syscall.SIGHUP))
+	select {
+	case value := <-changes:
+		assert.Equal(t, 9191, value)
+	case err = <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload not observed")
+	}
+}
+
+type restartConfig struct {
+	Listen  string         `yaml:"listen" readonly:""`
+	DataDir string         `yaml:"dataDir" restart:""`
+	Workers int            `yaml:"workers" restart:""`
+	Name    string         `yaml:"name"`
+	Core    *Configuration `yaml:"core"`
+}
+
+func Test_ReloadReadonly(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "listen: :8080\nname: demo\n")
+	config := &restartConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(file))
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(file, []byte("name: other\nlisten: :9090\n"), 0o600))
+	err = config.Core.reloadFile(context.Background())
+	if assert.Error(t, err) {
+		assert.Equal(t, file+":2:9: listen: reload rejected: read-only setting changed, restart to apply", err.Error())
+	}
+	assert.Equal(t, ":8080", config.Listen)
+	assert.Equal(t, "demo", config.Name)
+
+	assert.NoError(t, os.WriteFile(file, []byte("name: other\nlisten: :8080\n"), 0o600))
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+	assert.Equal(t, "other", config.Name)
+
+	// Nor can a read-only setting be changed at runtime.
+	for name, set := range map[string]func() error{
+		"Set":     func() error { return config.Core.Set("listen", ":7070") },
+		"Persist": func() error { return config.Core.Persist("listen", ":7070") },
+	} {
+		err = set()
+		if assert.Error(t, err, name) {
+			assert.ErrorIs(t, err, ErrReloadCoreConfig)
+			assert.Equal(t, "listen: reload rejected: read-only setting, restart to apply", err.Error())
+		}
+	}
+	assert.Equal(t, ":8080", config.Listen)
+	bs, _ := os.ReadFile(file)
+	assert.Equal(t, "name: other\nlisten: :8080\n", string(bs))
+}
+
+func Test_ReloadRestart(t *testing.T) {
+	file := writeManaged(t, "config.yaml", "dataDir: /var/a\nworkers: 2\n")
+	logger, _ := NewLogger()
+	config := &restartConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionLogger(logger),
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, config.Core.RestartRequired())
+
+	// Without a hook the restart is logged.
+	assert.NoError(t, os.WriteFile(file, []byte("dataDir: /var/b\nworkers: 2\nname: x\n"), 0o600))
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+	assert.Equal(t, "/var/b", config.DataDir)
+	assert.Equal(t, []string{"restart required: dataDir"}, warnings(logger))
+
+	var restarts [][]string
+	config.Core.AddOnRestart(func(settings []string) { restarts = append(restarts, settings) })
+	assert.NoError(t, os.WriteFile(file, []byte("dataDir: /var/b\nworkers: 4\nname: y\n"), 0o600))
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+	assert.NoError(t, os.WriteFile(file, []byte("dataDir: /var/b\nworkers: 4\nname: z\n"), 0o600))
+	assert.NoError(t, config.Core.reloadFile(context.Background()))
+	assert.Equal(t, [][]string{{"workers"}}, restarts)
+	assert.Equal(t, []string{"dataDir", "workers"}, config.Core.RestartRequired())
+	assert.Len(t, warnings(logger), 1)
+}
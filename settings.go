@@ -0,0 +1,428 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+	sourceSet     = "set"
+	redacted      = "******"
+)
+
+// setting describes a single leaf of the configuration structure, together
+// with the tags that control how it is loaded and documented.
+type setting struct {
+	path     string
+	field    reflect.StructField
+	value    reflect.Value
+	env      string
+	cmd      string
+	def      string
+	desc     string
+	validate string
+	secret   bool
+	source   string
+	loaded   interface{}
+
+	aliases     []string
+	envAliases  []string
+	flagAliases []string
+	deprecated  bool
+	readonly    bool
+	restart     bool
+
+	command    *Command
+	persistent bool
+}
+
+// ****** Collection **********************************************************
+
+func (c *Configuration) collectSetting(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+	s := &setting{
+		path:     key,
+		field:    ft,
+		value:    fv,
+		env:      c.expandEnvName(ft.Tag.Get("env")),
+		cmd:      ft.Tag.Get("cmd"),
+		def:      ft.Tag.Get("default"),
+		desc:     ft.Tag.Get("desc"),
+		validate: ft.Tag.Get("validate"),
+	}
+	_, s.secret = ft.Tag.Lookup("secret")
+	_, s.deprecated = ft.Tag.Lookup("deprecated")
+	_, s.readonly = ft.Tag.Lookup("readonly")
+	_, s.restart = ft.Tag.Lookup("restart")
+	c.parseAliases(s, ft.Tag.Get("alias"))
+	if s.env == "-" {
+		s.env = ""
+	}
+	if s.cmd == "-" {
+		s.cmd = ""
+	}
+	if c.binding != nil {
+		s.command = c.binding.command
+		s.persistent = c.binding.persistent
+	}
+	c.deriveNames(s)
+	// The built-in flags are recognized first, so a setting could never be
+	// given one of them.
+	for _, flag := range append([]string{s.cmd}, s.flagAliases...) {
+		if contains(builtinFlags, flag) {
+			return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: key, err: fmt.Errorf("flag %s is built in", flag)}
+		}
+	}
+	c.settings = append(c.settings, s)
+	return nil
+}
+
+func (c *Configuration) setting(path string) *setting {
+	for _, s := range c.settings {
+		if s.path == path {
+			return s
+		}
+	}
+	return nil
+}
+
+// settingByFlag finds the setting for a flag. Flags bound by a command are
+// only recognized once that command is selected, or below it when they are
+// persistent.
+func (c *Configuration) settingByFlag(flag string) *setting {
+	for _, s := range c.settings {
+		if (s.cmd == flag || contains(s.flagAliases, flag)) && (s.command == nil || s.persistent || s.command == c.command) {
+			return s
+		}
+	}
+	return nil
+}
+
+// expandEnvName replaces ${APPNAME} in an env tag with the application name,
+// upper-cased and with anything other than letters and digits replaced by _.
+func (c *Configuration) expandEnvName(env string) string {
+	if env == "" {
+		return ""
+	}
+	return strings.ReplaceAll(env, "${APPNAME}", c.envPrefix())
+}
+
+func (c *Configuration) envPrefix() string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, filepath.Base(c.Metadata.appName))
+}
+
+// display formats the setting's current value, hiding secrets.
+func (s *setting) display() string {
+	if s.secret && !s.value.IsZero() {
+		return redacted
+	}
+	return formatValue(s.value)
+}
+
+func formatValue(fv reflect.Value) string {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return ""
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Slice {
+		items := make([]string, 0, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			items = append(items, formatValue(fv.Index(i)))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprintf("%v", fv.Interface())
+}
+
+// ****** Access **************************************************************
+
+// Get returns the current value of the setting at the dotted path.
+func (c *Configuration) Get(path string) (interface{}, error) {
+	s := c.setting(path)
+	if s == nil {
+		return nil, &InvalidInitConfigError{Code: ErrUnknownKeyCoreConfig, Path: path, err: fmt.Errorf("unknown setting")}
+	}
+	return s.value.Interface(), nil
+}
+
+// Set parses value into the setting at the dotted path, validates it and,
+// when it differs from the current value, notifies the setting's monitors. A
+// setting tagged readonly cannot be set.
+func (c *Configuration) Set(path string, value string) error {
+	return c.setValue(path, value, sourceSet)
+}
+
+func (c *Configuration) setValue(path string, value interface{}, source string) error {
+	s := c.setting(path)
+	if s == nil {
+		return &InvalidInitConfigError{Code: ErrUnknownKeyCoreConfig, Path: path, err: fmt.Errorf("unknown setting")}
+	}
+	if s.readonly {
+		return &InvalidInitConfigError{Code: ErrReloadCoreConfig, Path: path, err: fmt.Errorf("read-only setting, restart to apply")}
+	}
+	fv := reflect.New(s.value.Type()).Elem()
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.IsValid() && rv.Type().AssignableTo(fv.Type()):
+		fv.Set(rv)
+	case rv.IsValid() && rv.Kind() == reflect.String:
+		if err := setFromString(fv, rv.String()); err != nil {
+			return &InvalidInitConfigError{Code: ErrTypeCoreConfig, Path: path, err: fmt.Errorf("expected %s", typeName(s.field.Type))}
+		}
+	case rv.IsValid() && rv.Type().ConvertibleTo(fv.Type()) && rv.Kind() != reflect.String && fv.Kind() != reflect.String:
+		fv.Set(rv.Convert(fv.Type()))
+	case !rv.IsValid():
+	default:
+		return &InvalidInitConfigError{Code: ErrTypeCoreConfig, Path: path, err: fmt.Errorf("expected %s", typeName(s.field.Type))}
+	}
+	if err := validateValue(s.validate, fv); err != nil {
+		return &InvalidInitConfigError{Code: ErrValidateCoreConfig, Path: path, err: err}
+	}
+	c.assign(s, fv, source)
+	return nil
+}
+
+// assign publishes a new value for a setting, notifying its monitors when
+// the value changed.
+func (c *Configuration) assign(s *setting, fv reflect.Value, source string) {
+	c.lock.Lock()
+	old := s.value.Interface()
+	changed := !reflect.DeepEqual(old, fv.Interface())
+	s.value.Set(fv)
+	s.source = source
+	c.lock.Unlock()
+	if changed {
+		c.audit(Diff{{Path: s.path, Kind: ChangeChanged, Old: old, New: fv.Interface(), Secret: s.secret}}, auditSet)
+		c.notify(s.path, fv.Interface())
+	}
+}
+
+// ****** Command line ********************************************************
+
+// parseArgs splits the command line into flag values keyed by setting path
+// and the remaining positional arguments. When a command tree is in use the
+// leading positional arguments select the command.
+func (c *Configuration) parseArgs() error {
+	c.flags = make(map[string]string)
+	c.sets = make(map[string]string)
+	c.args = nil
+	args := c.Metadata.args
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			c.args = append(c.args, args[i+1:]...)
+			return nil
+		case arg == completeFlag:
+			words := append([]string{}, args[i+1:]...)
+			if len(words) > 1 && c.command != nil {
+				c.Metadata.args = words[:len(words)-1]
+				_ = c.parseArgs()
+			}
+			c.Metadata.complete = words
+			return nil
+		case arg == "-h" || arg == "--help":
+			c.Metadata.help = true
+			continue
+		case arg == versionFlag || strings.HasPrefix(arg, versionFlag+"="):
+			c.Metadata.version = versionText
+			if _, format, ok := strings.Cut(arg, "="); ok {
+				if format != versionText && format != versionJSON {
+					return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: versionFlag, err: fmt.Errorf("unknown format %q", format)}
+				}
+				c.Metadata.version = format
+			}
+			continue
+		case arg == completionFlag || strings.HasPrefix(arg, completionFlag+"="):
+			shell, err := flagArg(args, &i)
+			if err != nil {
+				return err
+			}
+			c.Metadata.shell = shell
+			continue
+		case arg == setFlag || strings.HasPrefix(arg, setFlag+"="):
+			value, err := flagArg(args, &i)
+			if err == nil {
+				err = c.parseSet(value)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		case arg == configFlag || strings.HasPrefix(arg, configFlag+"="):
+			file, err := flagArg(args, &i)
+			if err != nil {
+				return err
+			}
+			c.Metadata.configFile = file
+			continue
+		case arg == configFormatFlag || strings.HasPrefix(arg, configFormatFlag+"="):
+			format, err := flagArg(args, &i)
+			if err == nil {
+				err = c.parseConfigFormat(format)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			if len(c.args) == 0 && c.command != nil && len(c.command.commands) > 0 {
+				if sub := c.command.find(arg); sub != nil {
+					if err := c.bindCommand(sub); err != nil {
+						return err
+					}
+					continue
+				} else if c.command.Run == nil {
+					return c.unknownCommand(arg)
+				}
+			}
+			c.args = append(c.args, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		s := c.settingByFlag(name)
+		if s == nil {
+			return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: name, err: fmt.Errorf("unknown flag")}
+		}
+		if name != s.cmd {
+			e := &InvalidInitConfigError{Code: ErrDeprecatedCoreConfig, Path: name, err: fmt.Errorf("deprecated, use %s", s.replacement("", s.cmd))}
+			if err := c.deprecate(e); err != nil {
+				return err
+			}
+		}
+		if !hasValue {
+			if s.value.Kind() == reflect.Bool {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return &InvalidInitConfigError{Code: ErrFlagCoreConfig, Path: name, err: fmt.Errorf("missing value")}
+			}
+		}
+		c.flags[s.path] = value
+	}
+	return nil
+}
+
+// ****** Processing **********************************************************
+
+func (c *Configuration) processDefault(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+	s := c.setting(key)
+	if s == nil {
+		return nil
+	}
+	if pos, ok := c.positions[key]; ok {
+		s.source = sourceFile
+		if pos.defaults {
+			s.source = sourceDefault
+		}
+		return nil
+	}
+	if s.def == "" || !fv.IsZero() {
+		return nil
+	}
+	if err := setFromString(fv, s.def); err != nil {
+		return &InvalidInitConfigError{Code: ErrTypeCoreConfig, Path: key, err: fmt.Errorf("default %q: expected %s", s.def, typeName(ft.Type))}
+	}
+	s.source = sourceDefault
+	return nil
+}
+
+func (c *Configuration) processEnvVar(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+	s := c.setting(key)
+	if s == nil {
+		return nil
+	}
+	name, value, ok := s.env, "", false
+	if name != "" {
+		value, ok = c.Metadata.environment.LookupEnv(name)
+	}
+	for _, alias := range s.envAliases {
+		if ok {
+			break
+		}
+		if value, ok = c.Metadata.environment.LookupEnv(alias); ok {
+			name = alias
+			e := &InvalidInitConfigError{Code: ErrDeprecatedCoreConfig, Path: "$" + alias, err: fmt.Errorf("deprecated, use %s", s.replacement("$", s.env))}
+			if err := c.deprecate(e); err != nil {
+				return err
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	if err := setFromString(fv, value); err != nil {
+		return &InvalidInitConfigError{Code: ErrTypeCoreConfig, Path: name, err: fmt.Errorf("expected %s", typeName(ft.Type))}
+	}
+	s.source = sourceEnv
+	return nil
+}
+
+func (c *Configuration) processFlag(fv reflect.Value, ft reflect.StructField, level int, key string) error {
+	value, ok := c.flags[key]
+	if !ok {
+		return nil
+	}
+	s := c.setting(key)
+	if err := setFromString(fv, value); err != nil {
+		return &InvalidInitConfigError{Code: ErrTypeCoreConfig, Path: s.cmd, err: fmt.Errorf("expected %s", typeName(ft.Type))}
+	}
+	s.source = sourceFlag
+	return nil
+}
+
+// parse decodes text, as typed by a user, into a new value of the setting's
+// type and checks it against the setting's validate tag.
+func (s *setting) parse(text string) (reflect.Value, error) {
+	fv := reflect.New(s.field.Type).Elem()
+	if text != "" {
+		if err := setFromString(fv, text); err != nil {
+			return fv, fmt.Errorf("expected %s", typeName(s.field.Type))
+		}
+	}
+	return fv, validateValue(s.validate, fv)
+}
+
+// setFromString decodes a textual value, as found in a tag, the environment or
+// on the command line, into a field. Lists are written comma separated.
+func setFromString(fv reflect.Value, value string) error {
+	if fv.Kind() == reflect.String {
+		fv.SetString(value)
+		return nil
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if fv.Kind() == reflect.Slice {
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, ",") {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: strings.TrimSpace(item)})
+		}
+	}
+	target := reflect.New(fv.Type())
+	if err := node.Decode(target.Interface()); err != nil {
+		return err
+	}
+	fv.Set(target.Elem())
+	return nil
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileSystem is where configuration files are read from, written to and
+// watched. The default is the operating system's file system.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	// WriteFile replaces the file with data, creating it and its directory
+	// when needed. Readers must never see a partially written file.
+	WriteFile(name string, data []byte) error
+	Stat(name string) (fs.FileInfo, error)
+	Watch(name string) (FileWatcher, error)
+}
+
+// FileWatcher reports changes to a watched file until it is closed, when
+// both channels are closed.
+type FileWatcher interface {
+	Changes() <-chan struct{}
+	Errors() <-chan error
+	Close() error
+}
+
+// Environment is where environment variables are looked up. The default is
+// the process environment.
+type Environment interface {
+	LookupEnv(key string) (string, bool)
+}
+
+// Clock creates the tickers that drive the periodic checks of the watcher.
+// The default is the system clock.
+type Clock interface {
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C, as time.Ticker does.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+type osFileSystem struct {
+	lock sync.Mutex
+	dirs map[string]*dirWatcher
+}
+
+// dirWatcher is the fsnotify watcher of a directory, shared by the watchers
+// of the files in it.
+type dirWatcher struct {
+	dir     string
+	watcher *fsnotify.Watcher
+	files   map[*osFileWatcher]struct{}
+}
+type osFileWatcher struct {
+	fs      *osFileSystem
+	dir     *dirWatcher
+	file    string
+	target  string
+	changes chan struct{}
+	errors  chan error
+	closed  bool
+}
+type fsFileSystem struct {
+	fsys fs.FS
+}
+type idleFileWatcher struct {
+	changes chan struct{}
+	errors  chan error
+	once    sync.Once
+}
+type osEnvironment struct{}
+type systemClock struct{}
+type systemTicker struct {
+	*time.Ticker
+}
+
+// ****** File system *********************************************************
+
+func (*osFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+func (*osFileSystem) WriteFile(name string, data []byte) error {
+	return writeFileAtomic(name, data)
+}
+func (*osFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+func (*osFileSystem) AppendFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Watch watches the directory holding the file, so that the file being
+// replaced by a rename is seen as well as it being written. For a symlink the
+// target is followed, so that a change of any link on the way, such as the
+// ..data link Kubernetes swaps to update a mounted ConfigMap, is seen too.
+// The files in a directory share one fsnotify watcher, closed with the last
+// of them.
+func (f *osFileSystem) Watch(name string) (FileWatcher, error) {
+	file, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	dir := f.dirs[filepath.Dir(file)]
+	if dir == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		if err = watcher.Add(filepath.Dir(file)); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+		dir = &dirWatcher{dir: filepath.Dir(file), watcher: watcher, files: make(map[*osFileWatcher]struct{})}
+		if f.dirs == nil {
+			f.dirs = make(map[string]*dirWatcher)
+		}
+		f.dirs[dir.dir] = dir
+		go f.run(dir)
+	}
+	w := &osFileWatcher{
+		fs:      f,
+		dir:     dir,
+		file:    file,
+		target:  resolveLink(file),
+		changes: make(chan struct{}, 1),
+		errors:  make(chan error, 1),
+	}
+	dir.files[w] = struct{}{}
+	return w, nil
+}
+
+// run passes the events of a directory to the watchers of its files until
+// the last of them is closed.
+func (f *osFileSystem) run(dir *dirWatcher) {
+	for {
+		select {
+		case event, ok := <-dir.watcher.Events:
+			if !ok {
+				return
+			}
+			f.lock.Lock()
+			for w := range dir.files {
+				w.event(event)
+			}
+			f.lock.Unlock()
+		case err, ok := <-dir.watcher.Errors:
+			if !ok {
+				return
+			}
+			f.lock.Lock()
+			for w := range dir.files {
+				select {
+				case w.errors <- err:
+				default:
+				}
+			}
+			f.lock.Unlock()
+		}
+	}
+}
+
+// event reports an event in the file's directory as a change when it is to
+// the file, or moved the target of the file's links.
+func (w *osFileWatcher) event(event fsnotify.Event) {
+	changed := filepath.Clean(event.Name) == w.file &&
+		event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0
+	if target := resolveLink(w.file); target != w.target {
+		w.target, changed = target, true
+	}
+	if changed {
+		select {
+		case w.changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// resolveLink returns the file a path finally refers to, or "" when it does
+// not currently exist.
+func resolveLink(file string) string {
+	target, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+func (w *osFileWatcher) Changes() <-chan struct{} {
+	return w.changes
+}
+func (w *osFileWatcher) Errors() <-chan error {
+	return w.errors
+}
+func (w *osFileWatcher) Close() error {
+	w.fs.lock.Lock()
+	defer w.fs.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.changes)
+	close(w.errors)
+	delete(w.dir.files, w)
+	if len(w.dir.files) > 0 {
+		return nil
+	}
+	delete(w.fs.dirs, w.dir.dir)
+	return w.dir.watcher.Close()
+}
+
+// ReadOnlyFileSystem reads configuration files from fsys, such as an embed.FS
+// or an fstest.MapFS. Names are slash-separated paths within fsys. Writing
+// fails with fs.ErrPermission, and files are never seen to change.
+func ReadOnlyFileSystem(fsys fs.FS) FileSystem {
+	return fsFileSystem{fsys: fsys}
+}
+
+func (f fsFileSystem) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(f.fsys, name)
+}
+func (f fsFileSystem) WriteFile(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+}
+func (f fsFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, name)
+}
+func (f fsFileSystem) Watch(name string) (FileWatcher, error) {
+	return &idleFileWatcher{changes: make(chan struct{}), errors: make(chan error)}, nil
+}
+
+func (w *idleFileWatcher) Changes() <-chan struct{} {
+	return w.changes
+}
+func (w *idleFileWatcher) Errors() <-chan error {
+	return w.errors
+}
+func (w *idleFileWatcher) Close() error {
+	w.once.Do(func() {
+		close(w.changes)
+		close(w.errors)
+	})
+	return nil
+}
+
+// ****** Environment and clock ***********************************************
+
+func (osEnvironment) LookupEnv(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// validateValue checks a value against a `validate:"..."` tag. Rules are comma
+// separated: required, min=N, max=N and oneof=a b c. min and max compare the
+// length of strings, lists and maps, and the value of numbers.
+func validateValue(tag string, fv reflect.Value) error {
+	if tag == "" {
+		return nil
+	}
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			if strings.Contains(","+tag+",", ",required,") {
+				return fmt.Errorf("value is required")
+			}
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			if fv.IsZero() {
+				return fmt.Errorf("value is required")
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s rule %q", name, arg)
+			}
+			actual, ok := measure(fv)
+			if !ok {
+				continue
+			}
+			if name == "min" && actual < limit {
+				return fmt.Errorf("must be at least %s", arg)
+			} else if name == "max" && actual > limit {
+				return fmt.Errorf("must be at most %s", arg)
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			actual := fmt.Sprintf("%v", fv.Interface())
+			found := false
+			for _, option := range options {
+				if option == actual {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+			}
+		case "":
+		default:
+			return fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+	return nil
+}
+
+func measure(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// enumValues returns the options of a oneof rule, if the tag has one.
+func enumValues(tag string) []string {
+	for _, rule := range strings.Split(tag, ",") {
+		if name, arg, _ := strings.Cut(strings.TrimSpace(rule), "="); name == "oneof" {
+			return strings.Fields(arg)
+		}
+	}
+	return nil
+}
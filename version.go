@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+)
+
+// Version, Commit and BuildDate override the build information Go records
+// in the binary, for builds that set them when linking:
+//
+//	go build -ldflags "-X github.com/jfigge/clif.Version=v1.2.0 -X github.com/jfigge/clif.Commit=$(git rev-parse HEAD)"
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+const (
+	versionFlag = "--version"
+	versionText = "text"
+	versionJSON = "json"
+)
+
+// BuildInfo describes how the application binary was built.
+type BuildInfo struct {
+	Version      string       `json:"version"`
+	Commit       string       `json:"commit,omitempty"`
+	Date         string       `json:"date,omitempty"`
+	Modified     bool         `json:"modified,omitempty"`
+	GoVersion    string       `json:"goVersion"`
+	Platform     string       `json:"platform"`
+	Module       string       `json:"module,omitempty"`
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// Dependency is a module the application was built with.
+type Dependency struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Replace string `json:"replace,omitempty"`
+}
+
+type versionConfig struct {
+	JSON bool `cmd:"--json" desc:"Print the build information as JSON"`
+}
+
+// ****** Build information ***************************************************
+
+// readBuildInfo collects the build information recorded by the Go toolchain
+// and applies the values set when linking.
+func readBuildInfo() *BuildInfo {
+	info := &BuildInfo{
+		Version:   "(devel)",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		if bi.Main.Version != "" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.Date = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+		for _, dep := range bi.Deps {
+			d := Dependency{Path: dep.Path, Version: dep.Version}
+			if dep.Replace != nil {
+				d.Replace = strings.TrimSpace(dep.Replace.Path + " " + dep.Replace.Version)
+			}
+			info.Dependencies = append(info.Dependencies, d)
+		}
+	}
+	if Version != "" {
+		info.Version = Version
+	}
+	if Commit != "" {
+		info.Commit = Commit
+	}
+	if BuildDate != "" {
+		info.Date = BuildDate
+	}
+	return info
+}
+
+// BuildInfo returns the version, commit, build date, Go version and module
+// dependencies of the application.
+func (m *configurationMetadata) BuildInfo() *BuildInfo {
+	return m.buildInfo
+}
+
+// WriteVersion writes the build information to w, as text or as JSON when
+// format is "json".
+func (c *Configuration) WriteVersion(w io.Writer, format string) error {
+	info := c.Metadata.buildInfo
+	if format == versionJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	commit := info.Commit
+	if info.Modified {
+		commit += " (modified)"
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "%s %s\n", filepath.Base(c.Metadata.appName), info.Version)
+	for _, line := range [][2]string{{"commit", commit}, {"built", info.Date}, {"go", info.GoVersion + " " + info.Platform}} {
+		if strings.TrimSpace(line[1]) != "" {
+			_, _ = fmt.Fprintf(tw, "  %s:\t%s\n", line[0], line[1])
+		}
+	}
+	if len(info.Dependencies) > 0 {
+		_, _ = fmt.Fprintln(tw, "  dependencies:")
+		for _, dep := range info.Dependencies {
+			if dep.Replace != "" {
+				_, _ = fmt.Fprintf(tw, "    %s\t%s\t=> %s\n", dep.Path, dep.Version, dep.Replace)
+			} else {
+				_, _ = fmt.Fprintf(tw, "    %s\t%s\n", dep.Path, dep.Version)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// NewVersionCommand returns a "version" command printing the build
+// information, as JSON with --json. Add it to an application's root command.
+func NewVersionCommand() *Command {
+	config := &versionConfig{}
+	return &Command{
+		Name:        "version",
+		Description: "Show the version and build information",
+		Args:        CommandArgsNone(),
+		Config:      config,
+		lenient:     true,
+		Run: func(ctx context.Context, cmd *Command, args []string) error {
+			format := versionText
+			if config.JSON {
+				format = versionJSON
+			}
+			c := cmd.Configuration()
+			return c.WriteVersion(c.Metadata.output, format)
+		},
+	}
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionVersion sets the version reported by --version and the
+// version command, in place of the one recorded in the binary.
+func ConfigurationOptionVersion(version string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.buildInfo.Version = version
+		return nil
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Version(t *testing.T) {
+	defer func(version, commit, date string) {
+		Version, Commit, BuildDate = version, commit, date
+	}(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.2.3", "abc123", "2024-05-01T10:00:00Z"
+
+	out := &bytes.Buffer{}
+	err := InitConfig(
+		context.Background(), &managedConfig{},
+		configurationOptionNoLoad(),
+		configurationOptionNoWatch(),
+		ConfigurationOptionAppName("/usr/bin/demo"),
+		ConfigurationOptionArgs([]string{"--version"}),
+		ConfigurationOptionOutput(out),
+	)
+	assert.ErrorIs(t, err, ErrVersionRequested)
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	assert.True(t, strings.HasPrefix(out.String(), "demo v1.2.3\n"+
+		"  commit:  abc123\n"+
+		"  built:   2024-05-01T10:00:00Z\n"+
+		"  go:      "+runtime.Version()+" "+platform+"\n"), out.String())
+
+	out.Reset()
+	err = InitConfig(
+		context.Background(), &managedConfig{},
+		configurationOptionNoLoad(),
+		configurationOptionNoWatch(),
+		ConfigurationOptionArgs([]string{"--version=json"}),
+		ConfigurationOptionOutput(out),
+		ConfigurationOptionVersion("v2.0.0"),
+	)
+	assert.ErrorIs(t, err, ErrVersionRequested)
+	info := &BuildInfo{}
+	if assert.NoError(t, json.Unmarshal(out.Bytes(), info)) {
+		assert.Equal(t, "v2.0.0", info.Version)
+		assert.Equal(t, "abc123", info.Commit)
+		assert.Equal(t, "2024-05-01T10:00:00Z", info.Date)
+		assert.Equal(t, runtime.Version(), info.GoVersion)
+		assert.Equal(t, platform, info.Platform)
+	}
+
+	err = InitConfig(
+		context.Background(), &managedConfig{},
+		configurationOptionNoLoad(),
+		configurationOptionNoWatch(),
+		ConfigurationOptionArgs([]string{"--version=xml"}),
+	)
+	if assert.Error(t, err) {
+		assert.Equal(t, `--version: unknown format "xml"`, err.Error())
+	}
+}
+
+func Test_VersionCommand(t *testing.T) {
+	defer func(version string) { Version = version }(Version)
+	Version = "v1.2.3"
+
+	file := writeManaged(t, "config.yaml", managedYAML)
+	run := func(args ...string) string {
+		out := &bytes.Buffer{}
+		root := (&Command{Name: "demo"}).AddCommand(NewVersionCommand())
+		err := root.Execute(
+			context.Background(), &managedConfig{}, args,
+			configurationOptionNoWatch(),
+			ConfigurationOptionConfigFile(file),
+			ConfigurationOptionAppName("demo"),
+			ConfigurationOptionOutput(out),
+		)
+		assert.NoError(t, err)
+		return out.String()
+	}
+
+	assert.True(t, strings.HasPrefix(run("version"), "demo v1.2.3\n"))
+	assert.True(t, strings.HasPrefix(run("--version"), "demo v1.2.3\n"))
+	assert.True(t, strings.HasPrefix(run("version", "--json"), "{\n  \"version\": \"v1.2.3\",\n"))
+	assert.Contains(t, run("--__complete", "--v"), "--version\tShow version")
+}
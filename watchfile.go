@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+var fileDebounce = 100 * time.Millisecond
+
+type ConfigurationFileFunc func(path string, data []byte)
+
+// watchedFile is a file, other than the configuration file, whose changes
+// are passed to a function by the watch goroutine.
+type watchedFile struct {
+	path       string
+	watcher    FileWatcher
+	changeFunc ConfigurationFileFunc
+	errorFunc  ConfigurationErrorFunc
+	hash       [sha256.Size]byte
+	pending    bool
+}
+
+// ****** Watched files *******************************************************
+
+// WatchFile calls changeFunc with the content of the file at path, and again
+// whenever the content changes, such as a certificate or an allow list the
+// application depends on. Changes arriving in quick succession are delivered
+// once they settle. A file replaced by swapping a symlink, as Kubernetes does
+// for a mounted ConfigMap, is seen as changed.
+//
+// Errors reading the file once it is being watched go to errorFunc, when
+// given, and otherwise to the ConfigurationOptionErrorNotify function. The
+// file is read once, without watching, when the configuration is not watched.
+// Once the context given to InitConfig is done, the file is not watched and
+// the context's error is returned.
+func (c *Configuration) WatchFile(path string, changeFunc ConfigurationFileFunc, errorFunc ...ConfigurationErrorFunc) error {
+	c.lock.Lock()
+	err := c.watchErr()
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	f := &watchedFile{path: path, changeFunc: changeFunc}
+	if len(errorFunc) > 0 {
+		f.errorFunc = errorFunc[0]
+	}
+	data, err := c.Metadata.fileSystem.ReadFile(path)
+	if err != nil {
+		return &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err}
+	}
+	f.hash = sha256.Sum256(data)
+	changeFunc(path, data)
+	if !c.Metadata.watch {
+		return nil
+	}
+	if f.watcher, err = c.Metadata.fileSystem.Watch(path); err != nil {
+		return &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: fmt.Errorf("watch %s: %w", path, err)}
+	}
+
+	// The watch goroutine closes the files it knows of as the context ends;
+	// checking under the same lock sees any file added too late for that.
+	c.lock.Lock()
+	if err = c.watchErr(); err != nil {
+		c.lock.Unlock()
+		_ = f.watcher.Close()
+		return err
+	}
+	c.files = append(c.files, f)
+	c.lock.Unlock()
+	select {
+	case c.filesChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// watchErr returns the error of the context the watch goroutine runs with,
+// once it is done. The caller holds the lock.
+func (c *configurationData) watchErr() error {
+	if c.watchCtx == nil {
+		return nil
+	}
+	return c.watchCtx.Err()
+}
+
+// watchedFiles returns the files currently being watched.
+func (c *configurationData) watchedFiles() []*watchedFile {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*watchedFile{}, c.files...)
+}
+
+// unwatchFile stops watching f, once its watcher has closed.
+func (c *configurationData) unwatchFile(f *watchedFile) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, file := range c.files {
+		if file == f {
+			c.files = append(c.files[:i], c.files[i+1:]...)
+			break
+		}
+	}
+}
+
+// closeFiles stops watching every file, as the watch goroutine ends.
+func (c *configurationData) closeFiles() {
+	c.lock.Lock()
+	files := c.files
+	c.files = nil
+	c.lock.Unlock()
+	for _, f := range files {
+		_ = f.watcher.Close()
+	}
+}
+
+// deliverFile reads a file that changed and, when its content differs from
+// what was last delivered, passes it to the file's function.
+func (c *Configuration) deliverFile(f *watchedFile) {
+	data, err := c.Metadata.fileSystem.ReadFile(f.path)
+	if err != nil {
+		c.fileError(f, &InvalidInitConfigError{Code: ErrFileReadCoreConfig, err: err})
+		return
+	}
+	hash := sha256.Sum256(data)
+	if hash == f.hash {
+		return
+	}
+	f.hash = hash
+	f.changeFunc(f.path, data)
+}
+
+func (c *configurationData) fileError(f *watchedFile, err error) {
+	if f.errorFunc != nil {
+		f.errorFunc(err)
+		return
+	}
+	c.notifyError(err)
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionDebounce sets how long the changes to a file watched by
+// WatchFile must settle before they are delivered, 100ms by default.
+func ConfigurationOptionDebounce(d time.Duration) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.debounce = d
+		return nil
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fileChange struct {
+	path string
+	data string
+}
+
+func watchFiles(t *testing.T) (*reloadConfig, chan fileChange, chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	config := &reloadConfig{}
+	err := InitConfig(
+		ctx, config,
+		ConfigurationOptionConfigFile(""),
+		ConfigurationOptionWaitGroup(wg),
+		ConfigurationOptionDebounce(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config, make(chan fileChange, 10), make(chan error, 10)
+}
+
+func awaitChange(t *testing.T, changes chan fileChange) fileChange {
+	t.Helper()
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not delivered")
+	}
+	return fileChange{}
+}
+
+func Test_WatchFile(t *testing.T) {
+	config, changes, errs := watchFiles(t)
+	file := writeManaged(t, "allow.txt", "alice\n")
+	err := config.Core.WatchFile(file, func(path string, data []byte) {
+		changes <- fileChange{path: path, data: string(data)}
+	}, func(err error) { errs <- err })
+	assert.NoError(t, err)
+	assert.Equal(t, fileChange{file, "alice\n"}, awaitChange(t, changes))
+
+	// Writes in quick succession are delivered once, when they settle.
+	assert.NoError(t, os.WriteFile(file, []byte("alice\nbob\n"), 0o600))
+	assert.NoError(t, os.WriteFile(file, []byte("alice\nbob\ncarol\n"), 0o600))
+	assert.Equal(t, fileChange{file, "alice\nbob\ncarol\n"}, awaitChange(t, changes))
+
+	assert.NoError(t, os.Remove(file))
+	select {
+	case err = <-errs:
+		assert.Contains(t, err.Error(), "open "+file)
+	case <-time.After(5 * time.Second):
+		t.Fatal("error not reported")
+	}
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected change %v", change)
+	default:
+	}
+
+	err = config.Core.WatchFile(file, func(path string, data []byte) {})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "open "+file)
+	}
+}
+
+func Test_WatchFileSymlinkSwap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	// The layout Kubernetes uses for a mounted ConfigMap.
+	dir := t.TempDir()
+	write := func(version string, data string) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, version), 0o700))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, version, "tls.crt"), []byte(data), 0o600))
+	}
+	write("..2024_01", "first")
+	assert.NoError(t, os.Symlink("..2024_01", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink("..data/tls.crt", filepath.Join(dir, "tls.crt")))
+
+	config, changes, _ := watchFiles(t)
+	file := filepath.Join(dir, "tls.crt")
+	err := config.Core.WatchFile(file, func(path string, data []byte) {
+		changes <- fileChange{path: path, data: string(data)}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "first", awaitChange(t, changes).data)
+
+	write("..2024_02", "second")
+	assert.NoError(t, os.Symlink("..2024_02", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "..2024_01")))
+	assert.Equal(t, fileChange{file, "second"}, awaitChange(t, changes))
+}
+
+func Test_WatchFileSharedDirectory(t *testing.T) {
+	config, changes, _ := watchFiles(t)
+	first := writeManaged(t, "first.txt", "one")
+	second := filepath.Join(filepath.Dir(first), "second.txt")
+	assert.NoError(t, os.WriteFile(second, []byte("two"), 0o600))
+	for _, file := range []string{first, second} {
+		err := config.Core.WatchFile(file, func(path string, data []byte) {
+			changes <- fileChange{path: path, data: string(data)}
+		})
+		assert.NoError(t, err)
+		awaitChange(t, changes)
+	}
+	// The files in a directory share one watcher, and each sees only its own
+	// changes.
+	fsys := config.Core.Metadata.fileSystem.(*osFileSystem)
+	fsys.lock.Lock()
+	assert.Len(t, fsys.dirs, 1)
+	fsys.lock.Unlock()
+	assert.NoError(t, os.WriteFile(second, []byte("changed"), 0o600))
+	assert.Equal(t, fileChange{second, "changed"}, awaitChange(t, changes))
+	assert.NoError(t, os.WriteFile(first, []byte("changed"), 0o600))
+	assert.Equal(t, fileChange{first, "changed"}, awaitChange(t, changes))
+
+	// The watcher is closed with the last of its files.
+	config.Core.closeFiles()
+	fsys.lock.Lock()
+	assert.Empty(t, fsys.dirs)
+	fsys.lock.Unlock()
+}
+
+func Test_WatchFileAfterDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	config := &reloadConfig{}
+	err := InitConfig(ctx, config, ConfigurationOptionConfigFile(""), ConfigurationOptionWaitGroup(wg))
+	assert.NoError(t, err)
+	cancel()
+	wg.Wait()
+
+	file := writeManaged(t, "allow.txt", "alice\n")
+	err = config.Core.WatchFile(file, func(path string, data []byte) {
+		t.Fatal("file delivered after the context is done")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, config.Core.watchedFiles())
+	assert.Empty(t, config.Core.Metadata.fileSystem.(*osFileSystem).dirs)
+}
+
+func Test_WatchFileNotWatched(t *testing.T) {
+	config := &reloadConfig{}
+	err := InitConfig(context.Background(), config, configurationOptionNoWatch(), ConfigurationOptionConfigFile(""))
+	assert.NoError(t, err)
+	file := writeManaged(t, "template.txt", "hello")
+	var delivered []string
+	assert.NoError(t, config.Core.WatchFile(file, func(path string, data []byte) {
+		delivered = append(delivered, string(data))
+	}))
+	assert.Equal(t, []string{"hello"}, delivered)
+	assert.Empty(t, config.Core.watchedFiles())
+}
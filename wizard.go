@@ -0,0 +1,309 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jfigge/clif/constants/color"
+	"github.com/jfigge/clif/constants/cursor"
+	"github.com/jfigge/clif/constants/keys"
+	"github.com/jfigge/clif/constants/screen"
+	"golang.org/x/term"
+)
+
+type keyFunc func(ctx context.Context) (keys.Key, error)
+
+// setupField is a setting the setup wizard asks for, with what has been
+// typed so far.
+type setupField struct {
+	s      *setting
+	enum   []string
+	input  []rune
+	edited bool
+}
+
+// ****** Setup ***************************************************************
+
+// setupConfig runs the setup wizard when the configuration file does not
+// exist. A file named without a directory is looked for, and created, in the
+// configuration directory, so the next run finds what the wizard wrote. The
+// wizard only runs on a terminal; elsewhere the missing file is reported as
+// usual.
+func (c *Configuration) setupConfig(ctx context.Context) error {
+	file := c.Metadata.configFile
+	if file == "" || file == stdinFile || !c.missing(file) {
+		return nil
+	}
+	if filepath.Base(file) == file && c.Metadata.configDir != "" {
+		file = filepath.Join(c.Metadata.configDir, file)
+		if !c.missing(file) {
+			c.Metadata.configFile = file
+			return nil
+		}
+	}
+
+	readKey := c.Metadata.readKey
+	if readKey == nil {
+		// The wizard only runs when its input is a terminal.
+		if f, ok := c.Metadata.input.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+			return nil
+		}
+		var stop func()
+		var err error
+		if readKey, stop, err = c.terminalKeys(ctx); err != nil {
+			return &InvalidInitConfigError{Code: ErrSetupCoreConfig, File: file, err: err}
+		}
+		defer stop()
+	}
+
+	doc := &document{file: file, format: c.formatOf(file), rt: reflect.TypeOf(c.root)}
+	out := c.Metadata.output
+	fields := c.setupFields()
+	fmt.Fprintf(out, "No configuration found, creating %s\r\n", file)
+	fmt.Fprintf(out, "%sEnter accepts, Tab cycles the choices, Esc cancels%s\r\n", color.Grey, color.Reset)
+	for i, f := range fields {
+		value, err := f.ask(ctx, out, i+1, len(fields), readKey)
+		if err != nil {
+			return &InvalidInitConfigError{Code: ErrSetupCoreConfig, File: file, Path: f.s.path, err: err}
+		}
+		if err = doc.set(f.s.path, value); err != nil {
+			return err
+		}
+	}
+	bs, err := doc.encode()
+	if err != nil {
+		return err
+	}
+	if err = c.Metadata.fileSystem.WriteFile(file, bs); err != nil {
+		return &InvalidInitConfigError{Code: ErrSetupCoreConfig, File: file, err: err}
+	}
+	fmt.Fprintf(out, "\r\nWrote %s\r\n", file)
+	c.Metadata.configFile = file
+	return nil
+}
+
+// missing reports whether file does not exist. Other errors are left for
+// the load to report.
+func (c *Configuration) missing(file string) bool {
+	_, err := c.Metadata.fileSystem.Stat(file)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// setupFields returns the required settings of the application, leaving out
+// those of commands and those already given by a flag, --set or the
+// environment.
+func (c *Configuration) setupFields() []*setupField {
+	var fields []*setupField
+	for _, s := range c.settings {
+		if s.command != nil || !hasRule(s.validate, "required") {
+			continue
+		}
+		if _, ok := c.flags[s.path]; ok {
+			continue
+		}
+		if _, ok := c.sets[s.path]; ok {
+			continue
+		}
+		if _, ok := c.Metadata.environment.LookupEnv(s.env); ok && s.env != "" {
+			continue
+		}
+		f := &setupField{s: s, enum: enumValues(s.validate)}
+		if f.enum == nil && s.field.Type.Kind() == reflect.Bool {
+			f.enum = []string{"true", "false"}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// terminalKeys puts the terminal in raw mode and reads it a key at a time.
+func (c *Configuration) terminalKeys(ctx context.Context) (keyFunc, func(), error) {
+	console, err := NewConsole(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyboard, err := NewKeyboard(ctx)
+	if err != nil {
+		console.StopConsole()
+		return nil, nil, err
+	}
+	fmt.Fprint(c.Metadata.output, fmt.Sprintf(screen.SetPosition, 1, 1)+screen.ClearDown+cursor.Show)
+	readKey := func(ctx context.Context) (keys.Key, error) {
+		select {
+		case keyboard.RequestChannel() <- true:
+		case <-ctx.Done():
+			return keys.Key{}, ctx.Err()
+		}
+		select {
+		case key := <-keyboard.KeyboardChannel():
+			return key, nil
+		case <-ctx.Done():
+			return keys.Key{}, ctx.Err()
+		}
+	}
+	stop := func() {
+		select {
+		case keyboard.RequestChannel() <- false:
+		case <-ctx.Done():
+		}
+		console.StopConsole()
+	}
+	return readKey, stop, nil
+}
+
+// ****** Fields **************************************************************
+
+// ask prompts for the field until a valid value is entered, validating it
+// as it is typed. An empty answer takes the default.
+func (f *setupField) ask(ctx context.Context, out io.Writer, n int, total int, readKey keyFunc) (interface{}, error) {
+	fmt.Fprintf(out, "\r\n%s(%d/%d) %s%s", color.Cyan, n, total, f.s.path, color.Reset)
+	if f.s.desc != "" {
+		fmt.Fprintf(out, " - %s", f.s.desc)
+	}
+	fmt.Fprint(out, "\r\n")
+	if f.enum != nil {
+		fmt.Fprintf(out, "  one of: %s\r\n", strings.Join(f.enum, ", "))
+	}
+	for {
+		f.render(out)
+		key, err := readKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch code := key.Ascii(); key.Modifier() {
+		case keys.ModifierControl:
+			switch code {
+			case 'M', 'J':
+				f.edited = true
+				if value, err := f.value(); err == nil {
+					fmt.Fprint(out, "\r\n")
+					return value, nil
+				}
+			case 'C':
+				return nil, fmt.Errorf("setup cancelled")
+			case 'H':
+				f.erase()
+			case 'U':
+				f.input, f.edited = nil, true
+			case 'I':
+				f.cycle(1)
+			}
+		case keys.Up.Modifier():
+			f.cycle(-1)
+		case keys.Down.Modifier():
+			f.cycle(1)
+		case keys.ModifierNone:
+			switch {
+			case code == 27:
+				return nil, fmt.Errorf("setup cancelled")
+			case code == 127:
+				f.erase()
+			case unicode.IsPrint(code):
+				f.input, f.edited = append(f.input, code), true
+			}
+		}
+	}
+}
+
+// value decodes and validates what has been typed, or the default.
+func (f *setupField) value() (interface{}, error) {
+	text := string(f.input)
+	if text == "" {
+		text = f.s.def
+	}
+	fv, err := f.s.parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return fv.Interface(), nil
+}
+
+// render redraws the input line: what has been typed, masked for a secret,
+// the default while nothing has been, and the problem with the value once
+// editing starts. The cursor is left at the end of the input.
+func (f *setupField) render(out io.Writer) {
+	text := string(f.input)
+	if f.s.secret {
+		text = strings.Repeat("*", len(f.input))
+	}
+	var tail string
+	back := 0
+	if len(f.input) == 0 && f.s.def != "" {
+		def := f.s.def
+		if f.s.secret {
+			def = redacted
+		}
+		tail += color.Grey + def + color.Reset
+		back += utf8.RuneCountInString(def)
+	}
+	if _, err := f.value(); err != nil && f.edited {
+		tail += "  " + color.Red + err.Error() + color.Reset
+		back += 2 + utf8.RuneCountInString(err.Error())
+	}
+	if back > 0 {
+		tail += fmt.Sprintf(screen.MoveLeft, back)
+	}
+	fmt.Fprint(out, "\r"+screen.ClearLine+"> "+text+tail)
+}
+
+func (f *setupField) erase() {
+	if len(f.input) > 0 {
+		f.input = f.input[:len(f.input)-1]
+	}
+	f.edited = true
+}
+
+// cycle replaces the input with the next, or previous, of the choices.
+func (f *setupField) cycle(step int) {
+	if len(f.enum) == 0 {
+		return
+	}
+	text := string(f.input)
+	if text == "" {
+		text = f.s.def
+	}
+	i := slices.Index(f.enum, text)
+	if i < 0 && step < 0 {
+		i = 0
+	}
+	i = (i + step + len(f.enum)) % len(f.enum)
+	f.input, f.edited = []rune(f.enum[i]), true
+}
+
+// hasRule reports whether the validate tag has the named rule.
+func hasRule(tag string, name string) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		if n, _, _ := strings.Cut(strings.TrimSpace(rule), "="); n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ****** Options *************************************************************
+
+// ConfigurationOptionSetupWizard walks the user through the required
+// settings when the configuration file does not exist, showing each one's
+// description, default and choices and validating the answer as it is typed,
+// then writes the answers to a new file in the configuration directory. The
+// wizard needs a terminal; without one the missing file is an error as usual.
+func ConfigurationOptionSetupWizard() ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.setup = true
+		return nil
+	}
+}
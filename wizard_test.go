@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2024 by Jason Figge
+ */
+
+package clif
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jfigge/clif/constants/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+type setupConfig struct {
+	Name  string         `yaml:"name" desc:"Service name" validate:"required"`
+	Mode  string         `yaml:"mode" default:"dev" validate:"required,oneof=dev test prod"`
+	Port  int            `yaml:"port" default:"8080" validate:"required,min=1024"`
+	Token string         `yaml:"token" env:"SETUP_TOKEN" secret:"" validate:"required"`
+	Tags  []string       `yaml:"tags"`
+	Core  *Configuration `yaml:"core"`
+}
+
+// typed feeds the wizard, or the editor, one key per byte of script, or per
+// escape sequence of a cursor key.
+func typed(script string) ConfigurationOption {
+	return func(c *Configuration) error {
+		c.Metadata.readKey = func(ctx context.Context) (keys.Key, error) {
+			if script == "" {
+				return keys.Key{}, io.EOF
+			}
+			n := 1
+			if strings.HasPrefix(script, "\x1b[") && len(script) > 2 {
+				n = 3
+			}
+			key, _ := keys.MakeKey([]byte(script[:n]))
+			script = script[n:]
+			return *key, nil
+		}
+		return nil
+	}
+}
+
+func Test_SetupWizard(t *testing.T) {
+	tests := map[string]struct {
+		script string
+		env    mapEnv
+		args   []string
+		expect string
+		output []string
+		error  string
+	}{
+		"Answers and defaults": {
+			script: "demo\r\r\rs3cret\r",
+			expect: "name: demo\nmode: dev\nport: 8080\ntoken: s3cret\n",
+			output: []string{"(1/4) name\x1b[0m - Service name", "one of: dev, test, prod", "> ******"},
+		},
+		"Validated as typed": {
+			script: "\rx\x7fdemo\r\t\t\r80\r\x7f\x7f9x\x7f080\rtok\r",
+			expect: "name: demo\nmode: prod\nport: 9080\ntoken: tok\n",
+			output: []string{"value is required", "must be at least 1024", "expected int"},
+		},
+		"Given elsewhere": {
+			script: "\r\r",
+			env:    mapEnv{"SETUP_TOKEN": "env"},
+			args:   []string{"--set", "name=flag"},
+			expect: "mode: dev\nport: 8080\n",
+		},
+		"Cancelled": {
+			script: "de\x1b",
+			error:  "name: setup cancelled",
+		},
+		"Interrupted": {
+			script: "demo\r\x03",
+			error:  "mode: setup cancelled",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			env := test.env
+			if env == nil {
+				env = mapEnv{}
+			}
+			out := &bytes.Buffer{}
+			config := &setupConfig{}
+			err := InitConfig(
+				context.Background(), config,
+				configurationOptionNoWatch(),
+				ConfigurationOptionSetupWizard(),
+				ConfigurationOptionConfigDir(dir),
+				ConfigurationOptionConfigFile("setup.yaml"),
+				ConfigurationOptionEnvironment(env),
+				ConfigurationOptionArgs(test.args),
+				ConfigurationOptionOutput(out),
+				typed(test.script),
+			)
+			file := filepath.Join(dir, "setup.yaml")
+			if test.error != "" {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, ErrSetupCoreConfig)
+					assert.Contains(t, err.Error(), test.error)
+				}
+				assert.NoFileExists(t, file)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			bs, err := os.ReadFile(file)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expect, string(bs))
+			assert.Equal(t, file, config.Core.Metadata.ConfigFile())
+			for _, s := range test.output {
+				assert.Contains(t, out.String(), s)
+			}
+		})
+	}
+}
+
+func Test_SetupWizardExisting(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "setup.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: demo\ntoken: t\n"), 0o600))
+
+	// The file in the configuration directory is found, and the wizard,
+	// which would fail on the first key, does not run.
+	config := &setupConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionSetupWizard(),
+		ConfigurationOptionConfigDir(dir),
+		ConfigurationOptionConfigFile("setup.yaml"),
+		ConfigurationOptionEnvironment(mapEnv{}),
+		typed(""),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "demo", config.Name)
+	assert.Equal(t, 8080, config.Port)
+	assert.Equal(t, file, config.Core.Metadata.ConfigFile())
+}
+
+func Test_SetupWizardNoTerminal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "setup.yaml")
+
+	// Input that is not a terminal cannot be asked, so no file is written and
+	// the missing file is reported.
+	config := &setupConfig{}
+	err := InitConfig(
+		context.Background(), config,
+		configurationOptionNoWatch(),
+		ConfigurationOptionSetupWizard(),
+		ConfigurationOptionConfigFile(file),
+		ConfigurationOptionEnvironment(mapEnv{}),
+		ConfigurationOptionInput(strings.NewReader("demo\r")),
+	)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoFileExists(t, file)
+}